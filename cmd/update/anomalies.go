@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	severityWarning = "warning"
+	severitySevere  = "severe"
+
+	// rejectedFile holds the findings of a run --strict refused to publish
+	rejectedFile = "anomalies.rejected.json"
+
+	defaultMaxStdDev   = 5.0
+	rateJumpWindow     = 250 // Number of most recent day-over-day changes used as baseline (~1 year)
+	rateJumpMinSamples = 20  // Minimum baseline size before rate jumps are evaluated
+)
+
+// Anomaly is a suspicious value found in the parsed data before publishing.
+type Anomaly struct {
+	Rule           string `json:"rule"`
+	Severity       string `json:"severity"`
+	Nome           string `json:"nome"`
+	DataVencimento string `json:"data_vencimento"`
+	DataBase       string `json:"data_base"`
+	Message        string `json:"message"`
+}
+
+type anomalyRules struct {
+	maxStdDev float64   // Rate jumps beyond this many standard deviations are flagged
+	today     time.Time // Reference date for future Data Base detection
+}
+
+// detectAnomalies runs the validation rules over every asset and returns the
+// anomalies found, sorted for stable output.
+func detectAnomalies(latest map[string]*assetRecord, rules anomalyRules) []Anomaly {
+	anomalies := []Anomaly{}
+
+	// An asset is active when it is quoted on the most recent Data Base of the feed
+	var maxDataBase time.Time
+	for _, asset := range latest {
+		if asset.dataBaseMax.After(maxDataBase) {
+			maxDataBase = asset.dataBaseMax
+		}
+	}
+	today := rules.today.Format("2006-01-02")
+
+	for _, asset := range latest {
+		rec := asset.record
+		add := func(rule, severity, format string, args ...interface{}) {
+			anomalies = append(anomalies, Anomaly{
+				Rule:           rule,
+				Severity:       severity,
+				Nome:           rec.Nome,
+				DataVencimento: rec.DataVencimento,
+				DataBase:       rec.DataBase,
+				Message:        fmt.Sprintf(format, args...),
+			})
+		}
+
+		if rec.PUCompraManha == 0 && rec.TaxaCompraManha != 0 {
+			add("zero_pu", severitySevere, "PU Compra Manha is zero with Taxa Compra Manha %v", rec.TaxaCompraManha)
+		}
+		if rec.PUVendaManha == 0 && rec.TaxaVendaManha != 0 {
+			add("zero_pu", severitySevere, "PU Venda Manha is zero with Taxa Venda Manha %v", rec.TaxaVendaManha)
+		}
+
+		// Buy rate is zero when the bond is not offered, so only compare quoted rates
+		if rec.TaxaCompraManha != 0 && rec.TaxaVendaManha != 0 && rec.TaxaCompraManha > rec.TaxaVendaManha {
+			add("buy_above_sell", severityWarning, "Taxa Compra Manha %v is above Taxa Venda Manha %v", rec.TaxaCompraManha, rec.TaxaVendaManha)
+		}
+
+		if rec.DataBase > today {
+			add("future_data_base", severitySevere, "Data Base %s is after %s", rec.DataBase, today)
+		}
+
+		if asset.dataBaseMax.Equal(maxDataBase) && rec.DataVencimento < rec.DataBase {
+			add("matured_active", severitySevere, "active bond has Data Vencimento %s before Data Base %s", rec.DataVencimento, rec.DataBase)
+		}
+
+		if rules.maxStdDev > 0 {
+			history := sortedHistory(asset.history)
+			rates := []struct {
+				name string
+				get  func(Record) float64
+			}{
+				{"Taxa Compra Manha", func(r Record) float64 { return r.TaxaCompraManha }},
+				{"Taxa Venda Manha", func(r Record) float64 { return r.TaxaVendaManha }},
+			}
+			for _, rate := range rates {
+				if jump, sigmas, ok := rateJump(history, rate.get, rules.maxStdDev); ok {
+					add("rate_jump", severityWarning, "%s moved %+.4f, %.1f standard deviations from its usual daily change", rate.name, jump, sigmas)
+				}
+			}
+		}
+	}
+
+	sort.Slice(anomalies, func(i, j int) bool {
+		a, b := anomalies[i], anomalies[j]
+		if a.Nome != b.Nome {
+			return a.Nome < b.Nome
+		}
+		if a.DataVencimento != b.DataVencimento {
+			return a.DataVencimento < b.DataVencimento
+		}
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.Message < b.Message
+	})
+
+	return anomalies
+}
+
+// rateJump compares the latest day-over-day change of a rate with the mean and
+// standard deviation of the previous changes. Changes to or from a zero rate are
+// ignored, since zero means the bond was not quoted.
+func rateJump(history []Record, get func(Record) float64, maxStdDev float64) (jump, sigmas float64, ok bool) {
+	var changes []float64
+	for i := 1; i < len(history); i++ {
+		prev, curr := get(history[i-1]), get(history[i])
+		if prev == 0 || curr == 0 {
+			continue
+		}
+		changes = append(changes, curr-prev)
+	}
+	if len(changes) < rateJumpMinSamples+1 {
+		return 0, 0, false
+	}
+
+	last := changes[len(changes)-1]
+	baseline := changes[:len(changes)-1]
+	if len(baseline) > rateJumpWindow {
+		baseline = baseline[len(baseline)-rateJumpWindow:]
+	}
+
+	var mean float64
+	for _, c := range baseline {
+		mean += c
+	}
+	mean /= float64(len(baseline))
+
+	var variance float64
+	for _, c := range baseline {
+		variance += (c - mean) * (c - mean)
+	}
+	stdDev := math.Sqrt(variance / float64(len(baseline)))
+	if stdDev == 0 {
+		return 0, 0, false
+	}
+
+	sigmas = math.Abs(last-mean) / stdDev
+	return last, sigmas, sigmas > maxStdDev
+}
+
+// sortedHistory returns a copy of the history ordered by Data Base.
+func sortedHistory(history []Record) []Record {
+	sorted := make([]Record, len(history))
+	copy(sorted, history)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].DataBase < sorted[j].DataBase
+	})
+	return sorted
+}
+
+func countSevere(anomalies []Anomaly) int {
+	n := 0
+	for _, a := range anomalies {
+		if a.Severity == severitySevere {
+			n++
+		}
+	}
+	return n
+}
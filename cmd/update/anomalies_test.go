@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const csvHeader = "Tipo Titulo;Data Vencimento;Data Base;Taxa Compra Manha;Taxa Venda Manha;PU Compra Manha;PU Venda Manha;PU Base Manha\n"
+
+func TestDetectAnomalies(t *testing.T) {
+	today := time.Date(2025, 12, 23, 0, 0, 0, 0, brt)
+
+	tests := []struct {
+		name      string
+		csv       string
+		wantRules []string
+		wantSev   []string
+	}{
+		{
+			name:      "clean data",
+			csv:       csvHeader + "Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76",
+			wantRules: nil,
+		},
+		{
+			name:      "zero PU with non-zero rate",
+			csv:       csvHeader + "Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;0;2348,76;2348,76",
+			wantRules: []string{"zero_pu"},
+			wantSev:   []string{severitySevere},
+		},
+		{
+			name:      "buy rate above sell rate",
+			csv:       csvHeader + "Tesouro IPCA+;15/05/2035;22/12/2025;7,50;7,41;2374,37;2348,76;2348,76",
+			wantRules: []string{"buy_above_sell"},
+			wantSev:   []string{severityWarning},
+		},
+		{
+			name:      "bond not offered is not flagged",
+			csv:       csvHeader + "Tesouro IPCA+;15/05/2035;22/12/2025;0,00;7,41;0,00;2348,76;2348,76",
+			wantRules: nil,
+		},
+		{
+			name:      "future Data Base",
+			csv:       csvHeader + "Tesouro IPCA+;15/05/2035;24/12/2025;7,29;7,41;2374,37;2348,76;2348,76",
+			wantRules: []string{"future_data_base"},
+			wantSev:   []string{severitySevere},
+		},
+		{
+			name: "maturity before Data Base on active bond",
+			csv: csvHeader +
+				"Tesouro Selic;01/03/2025;22/12/2025;0,00;0,03;3185,95;3183,49;3182,12\n" +
+				"Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76",
+			wantRules: []string{"matured_active"},
+			wantSev:   []string{severitySevere},
+		},
+		{
+			name: "matured bond no longer quoted is not flagged",
+			csv: csvHeader +
+				"Tesouro Selic;01/03/2025;01/03/2025;0,00;0,03;3185,95;3183,49;3182,12\n" +
+				"Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76",
+			wantRules: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			latest, err := parseCSV(strings.NewReader(tt.csv))
+			require.NoError(t, err)
+
+			anomalies := detectAnomalies(latest, anomalyRules{maxStdDev: defaultMaxStdDev, today: today})
+			require.Len(t, anomalies, len(tt.wantRules))
+			for i, a := range anomalies {
+				assert.Equal(t, tt.wantRules[i], a.Rule)
+				assert.Equal(t, tt.wantSev[i], a.Severity)
+			}
+		})
+	}
+}
+
+func TestDetectAnomaliesRateJump(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString(csvHeader)
+	day := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	rate := 7.0
+	for i := 0; i < 60; i++ {
+		// Alternate small moves of +/- 0.01
+		if i%2 == 0 {
+			rate += 0.01
+		} else {
+			rate -= 0.01
+		}
+		fmt.Fprintf(&sb, "Tesouro IPCA+;15/05/2035;%s;%s;%s;2374,37;2348,76;2348,76\n",
+			day.Format("02/01/2006"), formatFloatBR(rate), formatFloatBR(rate+0.12))
+		day = day.AddDate(0, 0, 1)
+	}
+	base := sb.String()
+	today := day.AddDate(0, 0, 1)
+
+	latest, err := parseCSV(strings.NewReader(base))
+	require.NoError(t, err)
+	assert.Empty(t, detectAnomalies(latest, anomalyRules{maxStdDev: defaultMaxStdDev, today: today}))
+
+	// A one-point jump is far beyond the usual daily change
+	jumped := base + fmt.Sprintf("Tesouro IPCA+;15/05/2035;%s;8,00;8,12;2374,37;2348,76;2348,76\n", day.Format("02/01/2006"))
+	latest, err = parseCSV(strings.NewReader(jumped))
+	require.NoError(t, err)
+	anomalies := detectAnomalies(latest, anomalyRules{maxStdDev: defaultMaxStdDev, today: today})
+	require.Len(t, anomalies, 2)
+	for _, a := range anomalies {
+		assert.Equal(t, "rate_jump", a.Rule)
+		assert.Equal(t, severityWarning, a.Severity)
+	}
+
+	// Disabled when the threshold is zero
+	assert.Empty(t, detectAnomalies(latest, anomalyRules{today: today}))
+}
+
+func TestCountSevere(t *testing.T) {
+	anomalies := []Anomaly{
+		{Severity: severityWarning},
+		{Severity: severitySevere},
+		{Severity: severitySevere},
+	}
+	assert.Equal(t, 2, countSevere(anomalies))
+	assert.Equal(t, 0, countSevere(nil))
+}
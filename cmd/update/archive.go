@@ -0,0 +1,268 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const archiveIndexFile = "index.json"
+
+// archiveEntry describes one archived upstream file.
+type archiveEntry struct {
+	SHA256        string   `json:"sha256"`     // Hex SHA-256 of the CSV, as in source_sha256
+	Path          string   `json:"path"`       // Relative to the archive directory
+	FetchedAt     string   `json:"fetched_at"` // RFC 3339, UTC; the first run that saw this file
+	SourceURL     string   `json:"source_url"`
+	ETag          string   `json:"etag,omitempty"`
+	LastModified  string   `json:"last_modified,omitempty"` // RFC 3339, UTC
+	Size          int64    `json:"size"`                    // Uncompressed bytes
+	Rows          int      `json:"rows"`                    // Data rows read
+	MaxDataBase   string   `json:"max_data_base" schema:"date-or-empty"`
+	Incremental   bool     `json:"incremental"`       // Assembled from a cached copy plus appended bytes, not downloaded in full
+	Options       []string `json:"options,omitempty"` // Flags that shaped the outputs of the run that archived it
+	RevisionsBase string   `json:"revisions_base"`    // Hash of the file that run compared revisions with; empty for none
+}
+
+// archiveIndex is archive/index.json, with entries ordered by fetched_at.
+type archiveIndex struct {
+	Entries []archiveEntry `json:"entries"`
+}
+
+// archiveWriter compresses the upstream CSV into the archive as it is parsed.
+// Files are named after their hash, so each distinct file is stored once.
+type archiveWriter struct {
+	dir  string
+	file *os.File
+	gz   *gzip.Writer
+	size int64
+}
+
+func newArchiveWriter(dir string) (*archiveWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(dir, "incoming-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	// The zero header has no name and no modification time
+	gz, err := gzip.NewWriterLevel(file, gzip.BestCompression)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return &archiveWriter{dir: dir, file: file, gz: gz}, nil
+}
+
+func (a *archiveWriter) Write(p []byte) (int, error) {
+	a.size += int64(len(p))
+	return a.gz.Write(p)
+}
+
+// abort discards the file. It is a no-op after commit.
+func (a *archiveWriter) abort() {
+	a.file.Close()
+	os.Remove(a.file.Name())
+}
+
+// commit stores the file as <sha256>.csv.gz and adds entry to the index,
+// unless that file is already archived. An incremental entry is marked as
+// downloaded in full once a full download gives the same bytes.
+func (a *archiveWriter) commit(entry archiveEntry) error {
+	defer a.abort()
+	if err := a.gz.Close(); err != nil {
+		return err
+	}
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+
+	index, err := readArchiveIndex(a.dir)
+	if err != nil {
+		return err
+	}
+	for i, e := range index.Entries {
+		if e.SHA256 != entry.SHA256 {
+			continue
+		}
+		if e.Incremental && !entry.Incremental {
+			index.Entries[i].Incremental = false
+			return writeJSON(index, filepath.Join(a.dir, archiveIndexFile))
+		}
+		return nil
+	}
+
+	entry.Path = entry.SHA256 + ".csv.gz"
+	entry.Size = a.size
+	if err := os.Rename(a.file.Name(), filepath.Join(a.dir, entry.Path)); err != nil {
+		return err
+	}
+
+	index.Entries = append(index.Entries, entry)
+	sort.SliceStable(index.Entries, func(i, j int) bool {
+		return index.Entries[i].FetchedAt < index.Entries[j].FetchedAt
+	})
+	return writeJSON(index, filepath.Join(a.dir, archiveIndexFile))
+}
+
+// readArchiveIndex reads dir/index.json. A missing index is an empty one.
+func readArchiveIndex(dir string) (archiveIndex, error) {
+	index := archiveIndex{Entries: []archiveEntry{}}
+	data, err := os.ReadFile(filepath.Join(dir, archiveIndexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return index, err
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return index, fmt.Errorf("invalid archive index: %w", err)
+	}
+	return index, nil
+}
+
+// findArchiveEntry selects the entry with the given hash (a prefix is
+// enough), or else the newest file fetched on or before date (yyyy-mm-dd,
+// Brasília time): the file that was current on that day.
+func findArchiveEntry(index archiveIndex, sha, date string) (archiveEntry, error) {
+	if sha != "" {
+		var found []archiveEntry
+		for _, e := range index.Entries {
+			if strings.HasPrefix(e.SHA256, sha) {
+				found = append(found, e)
+			}
+		}
+		switch len(found) {
+		case 0:
+			return archiveEntry{}, fmt.Errorf("no archived file with sha256 %s", sha)
+		case 1:
+			return found[0], nil
+		}
+		return archiveEntry{}, fmt.Errorf("sha256 prefix %s matches %d archived files", sha, len(found))
+	}
+
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return archiveEntry{}, fmt.Errorf("invalid date %q: expected yyyy-mm-dd", date)
+	}
+	var entry *archiveEntry
+	for i, e := range index.Entries {
+		fetched, err := time.Parse(time.RFC3339, e.FetchedAt)
+		if err != nil {
+			return archiveEntry{}, fmt.Errorf("archive entry %s: invalid fetched_at %q", e.SHA256, e.FetchedAt)
+		}
+		if fetched.In(brt).Format("2006-01-02") <= date {
+			entry = &index.Entries[i]
+		}
+	}
+	if entry == nil {
+		return archiveEntry{}, fmt.Errorf("no archived file fetched on or before %s", date)
+	}
+	return *entry, nil
+}
+
+// replayCommand implements `update replay`, regenerating the outputs of a
+// past run from its archived upstream file.
+func replayCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	archiveDir := flags.String("archive-dir", defaultArchiveDir, "Archive of upstream files")
+	date := flags.String("date", "", "Replay the file that was current on this day (yyyy-mm-dd)")
+	sha := flags.String("sha256", "", "Replay the archived file with this hash (or hash prefix)")
+	outDir := flags.String("outdir", "replay", "Output directory for the regenerated files")
+	signingKey := flags.String("signing-key", "", "File holding the base64 ed25519 key that signs SHA256SUMS (unsigned when empty)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if (*date == "") == (*sha == "") {
+		return fmt.Errorf("exactly one of --date and --sha256 is required")
+	}
+
+	index, err := readArchiveIndex(*archiveDir)
+	if err != nil {
+		return err
+	}
+	entry, err := findArchiveEntry(index, *sha, *date)
+	if err != nil {
+		return err
+	}
+	asOf, err := time.Parse(time.RFC3339, entry.FetchedAt)
+	if err != nil {
+		return fmt.Errorf("archive entry %s: invalid fetched_at %q", entry.SHA256, entry.FetchedAt)
+	}
+
+	// Run the update on the archived file as of the day it was fetched, with
+	// the options that shaped the outputs then
+	if entry.Options == nil {
+		fmt.Fprintf(out, "Warning: %s was archived without its options, replaying with the defaults\n", entry.SHA256)
+	}
+	cfg, err := parseConfig(entry.Options)
+	if err != nil {
+		return fmt.Errorf("archive entry %s: %w", entry.SHA256, err)
+	}
+	// A key from the environment is meant for the scheduled publish
+	cfg.signingKey = nil
+	if *signingKey != "" {
+		if cfg.signingKey, err = loadSigningKey(*signingKey); err != nil {
+			return fmt.Errorf("--signing-key: %w", err)
+		}
+	}
+	cfg.input = filepath.Join(*archiveDir, entry.Path)
+	cfg.replayOf = &entry
+	cfg.asOf = asOf
+	cfg.outDir = *outDir
+	cfg.archiveDir = *archiveDir // Read only, for revisions.json
+	cfg.keep = 0
+	cfg.force = true
+	// The guardrails judged this file when it was fetched
+	cfg.minRows = 0
+	cfg.maxBondDrop = 0
+	fmt.Fprintf(out, "Replaying %s (fetched %s) into %s\n", entry.SHA256, entry.FetchedAt, *outDir)
+	return run(cfg)
+}
+
+// outputOptions returns the flags that shape the published files, in command
+// line form, so replay can regenerate them the same way.
+func (cfg config) outputOptions() []string {
+	duplicates := cfg.duplicates
+	if duplicates == "" {
+		duplicates = duplicatesLast
+	}
+	options := []string{
+		"--duplicates=" + duplicates,
+		"--anomaly-stddev=" + strconv.FormatFloat(cfg.maxStdDev, 'g', -1, 64),
+		"--stale-after=" + strconv.Itoa(cfg.staleAfter),
+		"--compress=" + strconv.FormatBool(cfg.compress),
+	}
+	for _, out := range cfg.csvOutputs {
+		options = append(options, "--csv="+out.spec())
+	}
+	if len(cfg.csvDecimals) > 0 {
+		options = append(options, "--csv-decimals="+formatDecimals(cfg.csvDecimals))
+	}
+	return options
+}
+
+// latestDataBase returns the most recent Data Base across assets, as an ISO
+// date, or "" when there are none.
+func latestDataBase(latest map[string]*assetRecord) string {
+	var max time.Time
+	for _, asset := range latest {
+		if asset.dataBaseMax.After(max) {
+			max = asset.dataBaseMax
+		}
+	}
+	if max.IsZero() {
+		return ""
+	}
+	return max.Format("2006-01-02")
+}
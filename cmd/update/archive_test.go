@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunArchivesUpstreamFiles(t *testing.T) {
+	first := csvHeader +
+		"Tesouro IPCA+;15/05/2035;19/12/2025;7,30;7,42;2370,00;2345,00;2345,00\n"
+	second := first +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n"
+	root := t.TempDir()
+	archiveDir := filepath.Join(root, "archive")
+
+	runWith := func(body string, asOf time.Time) {
+		srv := newCSVServer(t, body)
+		cfg := config{url: srv.URL, outDir: filepath.Join(root, "public"), archiveDir: archiveDir, maxWarnings: -1, asOf: asOf, force: true}
+		require.NoError(t, run(cfg))
+	}
+	runWith(first, time.Date(2025, 12, 19, 21, 0, 0, 0, time.UTC))
+	runWith(second, time.Date(2025, 12, 22, 21, 0, 0, 0, time.UTC))
+	runWith(second, time.Date(2025, 12, 23, 21, 0, 0, 0, time.UTC))
+
+	index, err := readArchiveIndex(archiveDir)
+	require.NoError(t, err)
+	require.Len(t, index.Entries, 2, "an identical file is archived once")
+
+	entry := index.Entries[1]
+	assert.Equal(t, "2025-12-22T21:00:00Z", entry.FetchedAt)
+	assert.Equal(t, int64(len(second)), entry.Size)
+	assert.Equal(t, 2, entry.Rows)
+	assert.Equal(t, "2025-12-22", entry.MaxDataBase)
+	assert.Equal(t, entry.SHA256+".csv.gz", entry.Path)
+	assert.False(t, entry.Incremental)
+
+	envelope, ok := readPublishedEnvelope(filepath.Join(root, "public"))
+	require.True(t, ok)
+	assert.Equal(t, envelope.SourceSHA256, entry.SHA256)
+
+	file, err := os.Open(filepath.Join(archiveDir, entry.Path))
+	require.NoError(t, err)
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, second, string(data))
+
+	// No temp files are left behind
+	matches, err := filepath.Glob(filepath.Join(archiveDir, "*.tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestFindArchiveEntry(t *testing.T) {
+	index := archiveIndex{Entries: []archiveEntry{
+		{SHA256: "aaa111", FetchedAt: "2025-12-19T21:00:00Z"},
+		{SHA256: "bbb222", FetchedAt: "2025-12-22T21:00:00Z"},
+		// 01:00 UTC is still the 23rd in Brasília
+		{SHA256: "ccc333", FetchedAt: "2025-12-24T01:00:00Z"},
+	}}
+
+	tests := []struct {
+		sha, date string
+		want      string
+		wantErr   bool
+	}{
+		{date: "2025-12-19", want: "aaa111"},
+		{date: "2025-12-21", want: "aaa111"},
+		{date: "2025-12-22", want: "bbb222"},
+		{date: "2025-12-23", want: "ccc333"},
+		{date: "2026-01-05", want: "ccc333"},
+		{date: "2025-12-01", wantErr: true},
+		{date: "22/12/2025", wantErr: true},
+		{sha: "bbb", want: "bbb222"},
+		{sha: "ddd", wantErr: true},
+	}
+	for _, tt := range tests {
+		entry, err := findArchiveEntry(index, tt.sha, tt.date)
+		if tt.wantErr {
+			assert.Error(t, err, tt.sha+tt.date)
+			continue
+		}
+		require.NoError(t, err, tt.sha+tt.date)
+		assert.Equal(t, tt.want, entry.SHA256, tt.sha+tt.date)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	first := csvHeader +
+		"Tesouro IPCA+;15/05/2035;19/12/2025;7,30;7,42;2370,00;2345,00;2345,00\n"
+	// The second file also revises the 19th
+	second := csvHeader +
+		"Tesouro IPCA+;15/05/2035;19/12/2025;7,35;7,47;2365,00;2340,00;2340,00\n" +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n"
+	root := t.TempDir()
+	archiveDir := filepath.Join(root, "archive")
+	srv := newCSVServer(t, first)
+
+	us, err := parseCSVOutput("file=latest.us.csv,delimiter=comma,decimal=.,date=mm/dd/yyyy,lang=en")
+	require.NoError(t, err)
+	cfg := config{url: srv.URL, outDir: filepath.Join(root, "public"), archiveDir: archiveDir, maxWarnings: -1,
+		asOf:        time.Date(2025, 12, 19, 21, 0, 0, 0, time.UTC),
+		csvOutputs:  []csvOutput{us},
+		csvDecimals: map[string]int{"taxa_compra_manha": 3}}
+	require.NoError(t, run(cfg))
+	originalSums := map[string][]byte{}
+	originalSums["2025-12-20"], err = os.ReadFile(filepath.Join(cfg.outDir, checksumsFile))
+	require.NoError(t, err)
+	originalCSV, err := os.ReadFile(filepath.Join(cfg.outDir, "latest.us.csv"))
+	require.NoError(t, err)
+
+	cfg.url = newCSVServer(t, second).URL
+	cfg.asOf = time.Date(2025, 12, 22, 21, 0, 0, 0, time.UTC)
+	require.NoError(t, run(cfg))
+	originalSums["2025-12-22"], err = os.ReadFile(filepath.Join(cfg.outDir, checksumsFile))
+	require.NoError(t, err)
+	index, err := os.ReadFile(filepath.Join(archiveDir, archiveIndexFile))
+	require.NoError(t, err)
+
+	// Replaying a day regenerates what was published that day, revisions
+	// included, with the options of that run and without the key meant for
+	// the live publish
+	_, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	t.Setenv(signingKeyEnv, base64.StdEncoding.EncodeToString(priv.Seed()))
+	for date, sums := range originalSums {
+		replayDir := filepath.Join(root, "replay-"+date)
+		var out bytes.Buffer
+		require.NoError(t, replayCommand([]string{"--archive-dir", archiveDir, "--date", date, "--outdir", replayDir}, &out))
+		assert.Contains(t, out.String(), "Replaying")
+		assert.NotContains(t, out.String(), "Warning")
+
+		replayed, err := os.ReadFile(filepath.Join(replayDir, checksumsFile))
+		require.NoError(t, err)
+		assert.Equal(t, string(sums), string(replayed), date)
+		assert.NoFileExists(t, filepath.Join(replayDir, signatureFile))
+	}
+	replayedCSV, err := os.ReadFile(filepath.Join(root, "replay-2025-12-20", "latest.us.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, string(originalCSV), string(replayedCSV))
+	revisions, err := os.ReadFile(filepath.Join(root, "replay-2025-12-22", "revisions.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(revisions), `"pu_compra_manha": 2365`)
+
+	// The archive is left as it was
+	after, err := os.ReadFile(filepath.Join(archiveDir, archiveIndexFile))
+	require.NoError(t, err)
+	assert.Equal(t, string(index), string(after))
+
+	var out bytes.Buffer
+	assert.Error(t, replayCommand([]string{"--archive-dir", archiveDir}, &out))
+}
+
+func TestArchiveClearsIncrementalOnFullDownload(t *testing.T) {
+	dir := t.TempDir()
+	commit := func(incremental bool) {
+		archive, err := newArchiveWriter(dir)
+		require.NoError(t, err)
+		_, err = archive.Write([]byte(csvHeader))
+		require.NoError(t, err)
+		require.NoError(t, archive.commit(archiveEntry{SHA256: "aaa111", FetchedAt: "2025-12-22T21:00:00Z", Incremental: incremental}))
+	}
+
+	commit(true)
+	index, err := readArchiveIndex(dir)
+	require.NoError(t, err)
+	require.Len(t, index.Entries, 1)
+	assert.True(t, index.Entries[0].Incremental)
+
+	// Another incremental download proves nothing more
+	commit(true)
+	index, err = readArchiveIndex(dir)
+	require.NoError(t, err)
+	assert.True(t, index.Entries[0].Incremental)
+
+	commit(false)
+	index, err = readArchiveIndex(dir)
+	require.NoError(t, err)
+	require.Len(t, index.Entries, 1)
+	assert.False(t, index.Entries[0].Incremental)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cacheMeta describes the cached upstream body, stored next to it.
+type cacheMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"` // Raw HTTP date, sent back as If-Modified-Since
+	SHA256       string `json:"sha256"`
+	FetchedAt    string `json:"fetched_at"`  // RFC 3339, UTC
+	FullAt       string `json:"full_at"`     // Last download of the whole file, RFC 3339, UTC
+	Incremental  bool   `json:"incremental"` // Extended with appended bytes since FullAt (see cacheTailSize)
+}
+
+// rawCache keeps the last upstream CSV, as downloaded, so an unchanged file is
+// neither downloaded nor parsed again.
+type rawCache struct {
+	dir string
+}
+
+func (c rawCache) bodyPath() string { return filepath.Join(c.dir, "source.csv") }
+func (c rawCache) metaPath() string { return filepath.Join(c.dir, "source.json") }
+
+// load returns the cached entry for url. An entry for another URL, or whose
+// body no longer matches its hash, is ignored.
+func (c rawCache) load(url string) (cacheMeta, bool) {
+	var meta cacheMeta
+	data, err := os.ReadFile(c.metaPath())
+	if err != nil || json.Unmarshal(data, &meta) != nil || meta.URL != url {
+		return meta, false
+	}
+	sum, err := fileSHA256(c.bodyPath())
+	if err != nil || sum != meta.SHA256 {
+		return meta, false
+	}
+	return meta, true
+}
+
+// cacheTailSize is how much of the end of the cached body is downloaded again
+// to check that upstream only appended to it.
+const cacheTailSize = 64 << 10
+
+// cacheFullRefresh is how long a cached body may be extended by appended bytes
+// before the whole file is downloaded again. Only the tail of the cached copy
+// is compared with upstream, so this bounds how long a revision further back
+// can go unnoticed. It spans several daily runs, which would otherwise all
+// download in full.
+const cacheFullRefresh = 7 * 24 * time.Hour
+
+// errIncremental means the cached body could not be extended, usually because
+// upstream changed more than its end.
+var errIncremental = errors.New("incremental download failed")
+
+// fetch returns the cached body for url, updated first when upstream changed.
+// With a cached copy, only its tail and the bytes appended after it are
+// downloaded; a full download is the fallback, and is forced once the last
+// one is older than cacheFullRefresh.
+func (c rawCache) fetch(f *fetcher, url string) (source, error) {
+	cached, ok := c.load(url)
+
+	var meta cacheMeta
+	var err error
+	if ok && !fullRefreshDue(cached) {
+		meta, err = c.fetchAppended(f, url, cached)
+		if errors.Is(err, errIncremental) {
+			fmt.Fprintf(os.Stderr, "Warning: %v, downloading the full file\n", err)
+			meta, err = c.fetchFull(f, url)
+		}
+	} else {
+		meta, err = c.fetchFull(f, url)
+	}
+	if err != nil {
+		return source{}, err
+	}
+
+	body, err := os.Open(c.bodyPath())
+	if err != nil {
+		return source{}, err
+	}
+	return source{
+		body:         body,
+		sha256:       meta.SHA256,
+		lastModified: formatLastModified(meta.LastModified),
+		etag:         meta.ETag,
+		cacheHit:     ok && meta.SHA256 == cached.SHA256,
+		incremental:  meta.Incremental,
+	}, nil
+}
+
+func (c rawCache) fetchFull(f *fetcher, url string) (cacheMeta, error) {
+	resp, err := f.download(url, nil)
+	if err != nil {
+		return cacheMeta{}, err
+	}
+	defer resp.Body.Close()
+	return c.store(url, resp.Header, resp.ContentLength, "", resp.Body)
+}
+
+// fullRefreshDue reports whether the cached body was last downloaded in full more
+// than cacheFullRefresh ago, or before full downloads were recorded.
+func fullRefreshDue(cached cacheMeta) bool {
+	full, err := time.Parse(time.RFC3339, cached.FullAt)
+	return err != nil || time.Since(full) > cacheFullRefresh
+}
+
+// fetchAppended makes a conditional Range request starting cacheTailSize bytes
+// before the end of the cached body. A 304 keeps the cache as is. Otherwise
+// the returned tail must match the cached one, and the bytes after it are
+// appended to the cache.
+func (c rawCache) fetchAppended(f *fetcher, url string, cached cacheMeta) (cacheMeta, error) {
+	file, err := os.Open(c.bodyPath())
+	if err != nil {
+		return cacheMeta{}, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return cacheMeta{}, err
+	}
+	offset := info.Size() - min(cacheTailSize, info.Size())
+
+	header := http.Header{}
+	header.Set("User-Agent", userAgent)
+	header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	if cached.ETag != "" {
+		header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		header.Set("If-Modified-Since", cached.LastModified)
+	}
+	resp, err := f.do(url, header)
+	if err != nil {
+		return cacheMeta{}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return cached, nil
+	case http.StatusOK:
+		// The server ignored the range and sent the whole file
+		if err := checkContentType(resp.Header); err != nil {
+			return cacheMeta{}, err
+		}
+		return c.store(url, resp.Header, resp.ContentLength, "", resp.Body)
+	case http.StatusPartialContent:
+		if err := checkContentType(resp.Header); err != nil {
+			return cacheMeta{}, err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		return cacheMeta{}, fmt.Errorf("%w: upstream is shorter than the cached copy", errIncremental)
+	default:
+		return cacheMeta{}, &statusError{resp.StatusCode}
+	}
+
+	// The response must hold everything from offset to the end of a file no
+	// shorter than the cached one. A file that changed without growing was
+	// revised somewhere, and only a full download tells where.
+	contentRange := resp.Header.Get("Content-Range")
+	total := contentRangeTotal(contentRange)
+	if total < info.Size() || contentRange != fmt.Sprintf("bytes %d-%d/%d", offset, total-1, total) {
+		return cacheMeta{}, fmt.Errorf("%w: unexpected Content-Range %q", errIncremental, contentRange)
+	}
+	if resp.ContentLength >= 0 && resp.ContentLength != total-offset {
+		return cacheMeta{}, fmt.Errorf("%w: Content-Length %d does not match Content-Range %q", errIncremental, resp.ContentLength, contentRange)
+	}
+	if etag := resp.Header.Get("ETag"); total == info.Size() && (etag == "" || etag != cached.ETag) {
+		return cacheMeta{}, fmt.Errorf("%w: upstream changed without growing", errIncremental)
+	}
+	cachedTail := make([]byte, info.Size()-offset)
+	if _, err := file.ReadAt(cachedTail, offset); err != nil {
+		return cacheMeta{}, err
+	}
+	tail := make([]byte, len(cachedTail))
+	if _, err := io.ReadFull(resp.Body, tail); err != nil {
+		return cacheMeta{}, fmt.Errorf("%w: %v", errIncremental, err)
+	}
+	if !bytes.Equal(tail, cachedTail) {
+		return cacheMeta{}, fmt.Errorf("%w: the end of the cached copy changed upstream", errIncremental)
+	}
+
+	// A broken transfer of the new bytes also falls back to a full download
+	meta, err := c.store(url, resp.Header, total, cached.FullAt, io.NewSectionReader(file, 0, info.Size()), resp.Body)
+	if err != nil {
+		return cacheMeta{}, fmt.Errorf("%w: %v", errIncremental, err)
+	}
+	return meta, nil
+}
+
+// store writes the concatenation of parts as the cached body, hashing it on
+// the way, and records the validators from header. The body must be size
+// bytes long, unless size is -1. fullAt is when the body was last downloaded
+// in full; empty means now.
+func (c rawCache) store(url string, header http.Header, size int64, fullAt string, parts ...io.Reader) (cacheMeta, error) {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return cacheMeta{}, err
+	}
+
+	tmpPath := c.bodyPath() + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return cacheMeta{}, err
+	}
+	defer os.Remove(tmpPath)
+	defer file.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(file, io.TeeReader(io.MultiReader(parts...), h))
+	if err != nil {
+		return cacheMeta{}, err
+	}
+	if size >= 0 && n != size {
+		return cacheMeta{}, fmt.Errorf("download truncated: read %d of %d bytes", n, size)
+	}
+	if err := file.Close(); err != nil {
+		return cacheMeta{}, err
+	}
+	if err := os.Rename(tmpPath, c.bodyPath()); err != nil {
+		return cacheMeta{}, err
+	}
+
+	meta := cacheMeta{
+		URL:          url,
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		SHA256:       hex.EncodeToString(h.Sum(nil)),
+		FetchedAt:    time.Now().UTC().Format(time.RFC3339),
+		FullAt:       fullAt,
+		Incremental:  fullAt != "",
+	}
+	if meta.FullAt == "" {
+		meta.FullAt = meta.FetchedAt
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return cacheMeta{}, err
+	}
+	return meta, writeFileAtomic(c.metaPath(), append(data, '\n'))
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// conditionalServer serves *body with validators derived from it, honouring
+// If-None-Match unless ignoreValidators is set. It counts full responses.
+type conditionalServer struct {
+	body             atomic.Value
+	ignoreValidators atomic.Bool
+	fullResponses    atomic.Int32
+}
+
+func newConditionalServer(t *testing.T, body string) (*conditionalServer, *httptest.Server) {
+	cs := &conditionalServer{}
+	cs.body.Store(body)
+	lastModified := time.Date(2025, 12, 22, 18, 30, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := cs.body.Load().(string)
+		etag := fmt.Sprintf(`"%x"`, sha256.Sum256([]byte(body)))
+		if !cs.ignoreValidators.Load() && r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		cs.fullResponses.Add(1)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return cs, srv
+}
+
+func TestRawCacheFetch(t *testing.T) {
+	body := csvHeader + "Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n"
+	cs, srv := newConditionalServer(t, body)
+	cache := rawCache{dir: filepath.Join(t.TempDir(), "cache")}
+
+	fetch := func(t *testing.T) (source, string) {
+		src, err := cache.fetch(newFetcher(0, 0, 0), srv.URL)
+		require.NoError(t, err)
+		defer src.body.Close()
+		data, err := io.ReadAll(src.body)
+		require.NoError(t, err)
+		return src, string(data)
+	}
+
+	// First run downloads and stores the body
+	src, data := fetch(t)
+	assert.Equal(t, body, data)
+	assert.False(t, src.cacheHit)
+	assert.Equal(t, "2025-12-22T18:30:00Z", src.lastModified)
+	assert.Len(t, src.sha256, 64)
+	firstHash := src.sha256
+
+	var meta cacheMeta
+	raw, err := os.ReadFile(cache.metaPath())
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(raw, &meta))
+	assert.Equal(t, srv.URL, meta.URL)
+	assert.Equal(t, "Mon, 22 Dec 2025 18:30:00 GMT", meta.LastModified)
+
+	// Unchanged upstream answers 304 and the cached body is reused
+	src, data = fetch(t)
+	assert.True(t, src.cacheHit)
+	assert.Equal(t, body, data)
+	assert.Equal(t, firstHash, src.sha256)
+	assert.Equal(t, int32(1), cs.fullResponses.Load())
+
+	// A full response with the same bytes still counts as a hit
+	cs.ignoreValidators.Store(true)
+	src, _ = fetch(t)
+	assert.True(t, src.cacheHit)
+	assert.Equal(t, int32(2), cs.fullResponses.Load())
+
+	// New upstream data replaces the cache
+	changed := body + "Tesouro Selic;01/03/2031;22/12/2025;0,07;0,08;17995,73;17967,28;17967,28\n"
+	cs.body.Store(changed)
+	src, data = fetch(t)
+	assert.False(t, src.cacheHit)
+	assert.Equal(t, changed, data)
+	assert.NotEqual(t, firstHash, src.sha256)
+}
+
+func TestRawCacheIgnoresCorruptEntry(t *testing.T) {
+	body := csvHeader + "Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n"
+	cs, srv := newConditionalServer(t, body)
+	cache := rawCache{dir: t.TempDir()}
+
+	src, err := cache.fetch(newFetcher(0, 0, 0), srv.URL)
+	require.NoError(t, err)
+	src.body.Close()
+
+	// A body that no longer matches its hash is downloaded again
+	require.NoError(t, os.WriteFile(cache.bodyPath(), []byte("edited"), 0644))
+	_, ok := cache.load(srv.URL)
+	assert.False(t, ok)
+	src, err = cache.fetch(newFetcher(0, 0, 0), srv.URL)
+	require.NoError(t, err)
+	src.body.Close()
+	assert.False(t, src.cacheHit)
+	assert.Equal(t, int32(2), cs.fullResponses.Load())
+
+	// So is an entry for another URL
+	_, ok = cache.load(srv.URL + "/other")
+	assert.False(t, ok)
+}
+
+func TestRunWithCacheSkipsParsing(t *testing.T) {
+	body := csvHeader + "Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n"
+	_, srv := newConditionalServer(t, body)
+	root := t.TempDir()
+	cfg := config{url: srv.URL, outDir: filepath.Join(root, "public"), cacheDir: filepath.Join(root, "cache"), maxWarnings: -1}
+
+	require.NoError(t, run(cfg))
+	envelope, ok := readPublishedEnvelope(cfg.outDir)
+	require.True(t, ok)
+	assert.Equal(t, "2025-12-22T18:30:00Z", envelope.SourceLastModified)
+
+	require.ErrorIs(t, run(cfg), errUnchanged)
+	raw, err := os.ReadFile(filepath.Join(cfg.outDir, "run.json"))
+	require.NoError(t, err)
+	var report runReport
+	require.NoError(t, json.Unmarshal(raw, &report))
+	assert.Equal(t, statusUnchanged, report.Status)
+	assert.True(t, report.CacheHit)
+	assert.Zero(t, report.RowsRead, "the cached body should not be parsed again")
+	assert.Equal(t, 1, report.Records)
+	assert.Equal(t, envelope.ContentSHA256, report.ContentSHA256)
+
+	// Another option parses the cached body again and republishes
+	cfg.duplicates = duplicatesFirst
+	require.NoError(t, run(cfg))
+	republished, ok := readPublishedEnvelope(cfg.outDir)
+	require.True(t, ok)
+	assert.NotEqual(t, envelope.SettingsSHA256, republished.SettingsSHA256)
+	assert.NotEqual(t, envelope.ContentSHA256, republished.ContentSHA256)
+}
+
+// rangeServer serves *body with http.ServeContent, which handles Range,
+// If-Range and If-None-Match, and counts the body bytes sent.
+type rangeServer struct {
+	body      atomic.Value
+	sent      atomic.Int64
+	noRanges  atomic.Bool
+	requests  atomic.Int32
+	lastRange atomic.Value
+}
+
+func newRangeServer(t *testing.T, body string) (*rangeServer, *httptest.Server) {
+	rs := &rangeServer{}
+	rs.body.Store(body)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rs.requests.Add(1)
+		rs.lastRange.Store(r.Header.Get("Range"))
+		if rs.noRanges.Load() {
+			r.Header.Del("Range")
+		}
+		body := rs.body.Load().(string)
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha256.Sum256([]byte(body))))
+		http.ServeContent(countingWriter{w, &rs.sent}, r, "", time.Time{}, strings.NewReader(body))
+	}))
+	t.Cleanup(srv.Close)
+	return rs, srv
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *atomic.Int64
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	w.n.Add(int64(len(p)))
+	return w.ResponseWriter.Write(p)
+}
+
+func TestRawCacheAppendOnly(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString(csvHeader)
+	for day := 1; sb.Len() < 3*cacheTailSize; day++ {
+		fmt.Fprintf(&sb, "Tesouro IPCA+;15/05/2035;%02d/01/2020;7,%02d;7,41;2374,37;2348,76;2348,76\n", day%28+1, day%100)
+	}
+	body := sb.String()
+	appended := "Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n"
+
+	fetch := func(t *testing.T, cache rawCache, url string) (source, string) {
+		src, err := cache.fetch(newFetcher(0, 0, 0), url)
+		require.NoError(t, err)
+		defer src.body.Close()
+		data, err := io.ReadAll(src.body)
+		require.NoError(t, err)
+		return src, string(data)
+	}
+
+	t.Run("appended rows", func(t *testing.T) {
+		rs, srv := newRangeServer(t, body)
+		cache := rawCache{dir: t.TempDir()}
+		fetch(t, cache, srv.URL)
+
+		rs.body.Store(body + appended)
+		rs.sent.Store(0)
+		src, data := fetch(t, cache, srv.URL)
+		assert.Equal(t, body+appended, data)
+		assert.False(t, src.cacheHit)
+		assert.True(t, src.incremental)
+		assert.Equal(t, fmt.Sprintf("bytes=%d-", len(body)-cacheTailSize), rs.lastRange.Load())
+		assert.Equal(t, int64(cacheTailSize+len(appended)), rs.sent.Load(), "only the tail and the new bytes should be sent")
+
+		sum := sha256.Sum256([]byte(body + appended))
+		assert.Equal(t, fmt.Sprintf("%x", sum), src.sha256)
+		meta, ok := cache.load(srv.URL)
+		require.True(t, ok)
+		assert.Equal(t, fmt.Sprintf(`"%x"`, sum), meta.ETag)
+
+		// Nothing new since: 304
+		rs.sent.Store(0)
+		src, _ = fetch(t, cache, srv.URL)
+		assert.True(t, src.cacheHit)
+		assert.Zero(t, rs.sent.Load())
+	})
+
+	t.Run("rewritten tail", func(t *testing.T) {
+		rs, srv := newRangeServer(t, body)
+		cache := rawCache{dir: t.TempDir()}
+		fetch(t, cache, srv.URL)
+
+		rewritten := body[:len(body)-10] + "9,99;1,00\n" + appended
+		rs.body.Store(rewritten)
+		rs.requests.Store(0)
+		_, data := fetch(t, cache, srv.URL)
+		assert.Equal(t, rewritten, data)
+		assert.Equal(t, int32(2), rs.requests.Load(), "a changed tail should fall back to a full download")
+	})
+
+	t.Run("revised without growing", func(t *testing.T) {
+		rs, srv := newRangeServer(t, body)
+		cache := rawCache{dir: t.TempDir()}
+		fetch(t, cache, srv.URL)
+
+		revised := strings.Replace(body, ";7,41;", ";7,42;", 1)
+		rs.body.Store(revised)
+		rs.requests.Store(0)
+		_, data := fetch(t, cache, srv.URL)
+		assert.Equal(t, revised, data)
+		assert.Equal(t, int32(2), rs.requests.Load(), "a changed file of the same size should fall back to a full download")
+	})
+
+	t.Run("periodic full refresh", func(t *testing.T) {
+		rs, srv := newRangeServer(t, body)
+		cache := rawCache{dir: t.TempDir()}
+		fetch(t, cache, srv.URL)
+
+		// A revision behind the compared tail goes unnoticed by an
+		// incremental download...
+		revised := strings.Replace(body, ";7,41;", ";7,42;", 1) + appended
+		rs.body.Store(revised)
+		_, data := fetch(t, cache, srv.URL)
+		assert.Equal(t, body+appended, data)
+
+		// ...until the next full download
+		meta, ok := cache.load(srv.URL)
+		require.True(t, ok)
+		assert.True(t, meta.Incremental)
+		meta.FullAt = time.Now().Add(-cacheFullRefresh - time.Hour).UTC().Format(time.RFC3339)
+		encoded, err := json.Marshal(meta)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(cache.metaPath(), encoded, 0644))
+
+		rs.requests.Store(0)
+		src, data := fetch(t, cache, srv.URL)
+		assert.Equal(t, revised, data)
+		assert.False(t, src.incremental)
+		assert.Equal(t, int32(1), rs.requests.Load())
+		assert.Empty(t, rs.lastRange.Load())
+	})
+
+	t.Run("shorter upstream", func(t *testing.T) {
+		rs, srv := newRangeServer(t, body)
+		cache := rawCache{dir: t.TempDir()}
+		fetch(t, cache, srv.URL)
+
+		rs.body.Store(csvHeader + appended)
+		_, data := fetch(t, cache, srv.URL)
+		assert.Equal(t, csvHeader+appended, data)
+	})
+
+	t.Run("no range support", func(t *testing.T) {
+		rs, srv := newRangeServer(t, body)
+		cache := rawCache{dir: t.TempDir()}
+		fetch(t, cache, srv.URL)
+
+		rs.noRanges.Store(true)
+		rs.body.Store(body + appended)
+		rs.requests.Store(0)
+		_, data := fetch(t, cache, srv.URL)
+		assert.Equal(t, body+appended, data)
+		assert.Equal(t, int32(1), rs.requests.Load())
+	})
+}
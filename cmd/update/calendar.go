@@ -0,0 +1,76 @@
+package main
+
+import "time"
+
+// easter returns Easter Sunday of year in the Gregorian calendar (anonymous
+// Gregorian algorithm).
+func easter(year int) time.Time {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// isHoliday reports whether d is a Brazilian national holiday on which the
+// Treasury does not quote: the fixed national holidays, plus Carnival, Good
+// Friday and Corpus Christi, which move with Easter.
+func isHoliday(d time.Time) bool {
+	switch month, day := d.Month(), d.Day(); {
+	case month == time.January && day == 1, // Confraternização Universal
+		month == time.April && day == 21,    // Tiradentes
+		month == time.May && day == 1,       // Dia do Trabalho
+		month == time.September && day == 7, // Independência
+		month == time.October && day == 12,  // Nossa Senhora Aparecida
+		month == time.November && day == 2,  // Finados
+		month == time.November && day == 15, // Proclamação da República
+		month == time.December && day == 25: // Natal
+		return true
+	case month == time.November && day == 20: // Consciência Negra, national since 2024
+		return d.Year() >= 2024
+	}
+
+	date := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC)
+	switch int(date.Sub(easter(d.Year())).Hours() / 24) {
+	case -48, -47, // Carnival Monday and Tuesday
+		-2, // Good Friday
+		60: // Corpus Christi
+		return true
+	}
+	return false
+}
+
+// isBusinessDay reports whether d is a weekday other than a national holiday.
+func isBusinessDay(d time.Time) bool {
+	switch d.Weekday() {
+	case time.Saturday, time.Sunday:
+		return false
+	}
+	return !isHoliday(d)
+}
+
+// nextBusinessDay returns the first business day after d.
+func nextBusinessDay(d time.Time) time.Time {
+	d = d.AddDate(0, 0, 1)
+	for !isBusinessDay(d) {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d
+}
+
+// businessDaysBetween counts the business days after from, up to and
+// including to. It is zero when to is not after from.
+func businessDaysBetween(from, to time.Time) int {
+	n := 0
+	for d := nextBusinessDay(from); !d.After(to); d = nextBusinessDay(d) {
+		n++
+	}
+	return n
+}
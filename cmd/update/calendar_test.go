@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEaster(t *testing.T) {
+	for year, want := range map[int]string{
+		2019: "2019-04-21",
+		2024: "2024-03-31",
+		2025: "2025-04-20",
+		2026: "2026-04-05",
+	} {
+		assert.Equal(t, want, easter(year).Format("2006-01-02"), year)
+	}
+}
+
+func TestIsBusinessDay(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		assert.NoError(t, err)
+		return d
+	}
+
+	for _, day := range []string{
+		"2025-03-03", "2025-03-04", // Carnival
+		"2025-04-18", // Good Friday
+		"2025-04-21", // Tiradentes
+		"2025-06-19", // Corpus Christi
+		"2025-11-20", // Consciência Negra
+		"2025-12-25",
+		"2025-12-20", "2025-12-21", // Weekend
+	} {
+		assert.False(t, isBusinessDay(date(day)), day)
+	}
+	for _, day := range []string{
+		"2025-03-05", // Ash Wednesday
+		"2023-11-20", // Not yet a national holiday
+		"2025-12-24",
+		"2025-12-22",
+	} {
+		assert.True(t, isBusinessDay(date(day)), day)
+	}
+
+	assert.Equal(t, "2025-03-05", nextBusinessDay(date("2025-02-28")).Format("2006-01-02"))
+	assert.Equal(t, 1, businessDaysBetween(date("2025-02-28"), date("2025-03-05")))
+	assert.Equal(t, 4, businessDaysBetween(date("2025-12-19"), date("2025-12-26")), "skips Christmas")
+	assert.Zero(t, businessDaysBetween(date("2025-12-19"), date("2025-12-21")))
+	assert.Zero(t, businessDaysBetween(date("2025-12-22"), date("2025-12-19")))
+}
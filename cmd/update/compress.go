@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// precompressedExts are formats that are already compressed internally and
+// gain nothing from another layer.
+var precompressedExts = map[string]bool{
+	".gz":      true,
+	".br":      true,
+	".zip":     true,
+	".xlsx":    true,
+	".parquet": true,
+}
+
+// brotliMaxBestSize caps the files compressed with brotli's best (and
+// slowest) quality. Larger files use the default quality.
+const brotliMaxBestSize = 1 << 20
+
+// compressOutputs writes a .gz and a .br variant next to every published file
+// under dir worth compressing, and removes variants whose original no longer
+// exists.
+func compressOutputs(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+
+		ext := filepath.Ext(path)
+		if ext == ".gz" || ext == ".br" {
+			if _, err := os.Stat(strings.TrimSuffix(path, ext)); os.IsNotExist(err) {
+				return os.Remove(path)
+			}
+			return nil
+		}
+		if precompressedExts[ext] {
+			return nil
+		}
+		return compressFile(path)
+	})
+}
+
+// compressMinSize is the smallest file given compressed variants. Below it
+// the format overhead eats the savings, and the variants only add files.
+const compressMinSize = 1 << 10
+
+// compressFile writes path.gz and path.br. Neither format stores a name or a
+// timestamp, so identical content always gives byte-identical variants. Files
+// under compressMinSize get none, nor does a variant that is not smaller than
+// the file; a variant left from an earlier run is then removed.
+func compressFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	variants := []struct {
+		ext      string
+		compress func([]byte) ([]byte, error)
+	}{
+		{".gz", gzipBytes},
+		{".br", brotliBytes},
+	}
+	for _, v := range variants {
+		var out []byte
+		if len(data) >= compressMinSize {
+			if out, err = v.compress(data); err != nil {
+				return err
+			}
+		}
+		if out == nil || len(out) >= len(data) {
+			if err := os.Remove(path + v.ext); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if err := writeFileAtomic(path+v.ext, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	// The zero header has no name and no modification time
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func brotliBytes(data []byte) ([]byte, error) {
+	quality := brotli.BestCompression
+	if len(data) > brotliMaxBestSize {
+		quality = brotli.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	bw := brotli.NewWriterLevel(&buf, quality)
+	if _, err := bw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := bw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
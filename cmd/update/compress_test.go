@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressOutputs(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte(strings.Repeat(`{"nome":"Tesouro IPCA+ 2035"}`+"\n", 100))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "bonds"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "latest.json"), content, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bonds", "tesouro-ipca-2035.json"), content, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tesouro.xlsx"), []byte("zip"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "removed.json.gz"), []byte("stale"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "removed.json.br"), []byte("stale"), 0644))
+
+	require.NoError(t, compressOutputs(dir))
+
+	for _, path := range []string{"latest.json", filepath.Join("bonds", "tesouro-ipca-2035.json")} {
+		full := filepath.Join(dir, path)
+
+		gz, err := os.Open(full + ".gz")
+		require.NoError(t, err)
+		zr, err := gzip.NewReader(gz)
+		require.NoError(t, err)
+		assert.True(t, zr.ModTime.IsZero(), "gzip header must not carry a timestamp")
+		assert.Empty(t, zr.Name)
+		data, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		gz.Close()
+		assert.Equal(t, content, data)
+
+		br, err := os.ReadFile(full + ".br")
+		require.NoError(t, err)
+		data, err = io.ReadAll(brotli.NewReader(bytes.NewReader(br)))
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+	}
+
+	// Already-compressed formats are left alone and orphans are removed
+	assert.NoFileExists(t, filepath.Join(dir, "tesouro.xlsx.gz"))
+	assert.NoFileExists(t, filepath.Join(dir, "removed.json.gz"))
+	assert.NoFileExists(t, filepath.Join(dir, "removed.json.br"))
+
+	// Unchanged content gives byte-identical variants on the next run
+	first, err := os.ReadFile(filepath.Join(dir, "latest.json.gz"))
+	require.NoError(t, err)
+	firstBr, err := os.ReadFile(filepath.Join(dir, "latest.json.br"))
+	require.NoError(t, err)
+	require.NoError(t, compressOutputs(dir))
+	second, err := os.ReadFile(filepath.Join(dir, "latest.json.gz"))
+	require.NoError(t, err)
+	secondBr, err := os.ReadFile(filepath.Join(dir, "latest.json.br"))
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, firstBr, secondBr)
+	assert.NoFileExists(t, filepath.Join(dir, "latest.json.gz.gz"))
+}
+
+func TestCompressFileSkipsUselessVariants(t *testing.T) {
+	dir := t.TempDir()
+
+	// A single-value file is far below the threshold, and a variant left
+	// from when it was larger goes away
+	small := filepath.Join(dir, "v", "tesouro-selic-2029", "taxa_compra.txt")
+	require.NoError(t, os.MkdirAll(filepath.Dir(small), 0755))
+	require.NoError(t, os.WriteFile(small, []byte("0.0512\n"), 0644))
+	require.NoError(t, os.WriteFile(small+".gz", []byte("stale"), 0644))
+	require.NoError(t, compressFile(small))
+	assert.NoFileExists(t, small+".gz")
+	assert.NoFileExists(t, small+".br")
+
+	// Random bytes do not compress, so neither variant would be smaller
+	noise := make([]byte, 4*compressMinSize)
+	_, err := rand.Read(noise)
+	require.NoError(t, err)
+	random := filepath.Join(dir, "random.bin")
+	require.NoError(t, os.WriteFile(random, noise, 0644))
+	require.NoError(t, compressFile(random))
+	assert.NoFileExists(t, random+".gz")
+	assert.NoFileExists(t, random+".br")
+
+	// At the threshold compressible content gets both
+	exact := filepath.Join(dir, "exact.json")
+	require.NoError(t, os.WriteFile(exact, bytes.Repeat([]byte("a"), compressMinSize), 0644))
+	require.NoError(t, compressFile(exact))
+	assert.FileExists(t, exact+".gz")
+	assert.FileExists(t, exact+".br")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// errUnchanged is returned by run when the parsed data matches the published
+// outputs, so nothing was written.
+var errUnchanged = errors.New("content unchanged since the last publish")
+
+// canonicalRow is the hashed form of one parsed row, including the raw bond
+// type that the JSON record does not carry.
+type canonicalRow struct {
+	TipoTitulo string `json:"tipo_titulo"`
+	Record
+}
+
+// outputFormatVersion is bumped whenever a writer changes what it produces
+// from the same rows, so the next run republishes instead of exiting
+// unchanged.
+const outputFormatVersion = 1
+
+// settingsHash returns the hex SHA-256 of the output format version and of
+// the options that shape the published files.
+func settingsHash(cfg config) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "output format %d\n", outputFormatVersion)
+	for _, option := range cfg.outputOptions() {
+		fmt.Fprintln(h, option)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// contentHash returns the hex SHA-256 of settings, a settingsHash, and of
+// every parsed row, in canonical order and encoding. Every published file is
+// derived from these rows with these settings, so an unchanged hash means
+// unchanged outputs.
+func contentHash(latest map[string]*assetRecord, settings string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintln(h, settings)
+	encoder := json.NewEncoder(h)
+	for _, asset := range sortedAssets(latest) {
+		for _, rec := range sortedHistory(asset.history) {
+			if err := encoder.Encode(canonicalRow{TipoTitulo: rec.tipoTitulo, Record: rec}); err != nil {
+				return "", err
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readPublishedEnvelope reads v2/latest.json from the live output directory.
+// It reports false when there is no readable previous publish.
+func readPublishedEnvelope(outDir string) (latestEnvelope, bool) {
+	var envelope latestEnvelope
+	data, err := os.ReadFile(filepath.Join(outDir, "v2", "latest.json"))
+	if err != nil {
+		return envelope, false
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return envelope, false
+	}
+	return envelope, true
+}
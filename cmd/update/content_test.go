@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentHash(t *testing.T) {
+	hash := func(body string) string {
+		latest, err := parseCSV(strings.NewReader(csvHeader + body))
+		require.NoError(t, err)
+		sum, err := contentHash(latest, "")
+		require.NoError(t, err)
+		return sum
+	}
+
+	rows := []string{
+		"Tesouro IPCA+;15/05/2035;19/12/2025;7,30;7,42;2370,00;2345,00;2345,00\n",
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n",
+		"Tesouro Selic;01/03/2031;22/12/2025;0,07;0,08;17995,73;17967,28;17967,28\n",
+	}
+	base := hash(rows[0] + rows[1] + rows[2])
+	assert.Len(t, base, 64)
+
+	// Row order in the source does not matter
+	assert.Equal(t, base, hash(rows[2]+rows[1]+rows[0]))
+
+	// A revised historical row does, even when the latest records are the same
+	revised := strings.Replace(rows[0], "7,30", "7,31", 1)
+	assert.NotEqual(t, base, hash(revised+rows[1]+rows[2]))
+
+	// So do the settings the outputs are written with
+	latest, err := parseCSV(strings.NewReader(csvHeader + rows[0]))
+	require.NoError(t, err)
+	plain, err := contentHash(latest, settingsHash(config{}))
+	require.NoError(t, err)
+	compressed, err := contentHash(latest, settingsHash(config{compress: true}))
+	require.NoError(t, err)
+	assert.NotEqual(t, plain, compressed)
+	assert.Equal(t, settingsHash(config{}), settingsHash(config{duplicates: duplicatesLast}))
+}
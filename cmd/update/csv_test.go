@@ -115,3 +115,40 @@ func TestSortRecords(t *testing.T) {
 	assert.Equal(t, "Tesouro Prefixado 2008", records[2].Nome)
 	assert.Equal(t, "Tesouro Selic 2010", records[3].Nome)
 }
+
+func TestParseCSVDiagnostics(t *testing.T) {
+	csv := csvHeader +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n" +
+		"Tesouro IPCA+;15/05/2035\n" +
+		"Tesouro IPCA+;15/05/2035;31/02/2025;7,29;7,41;2374,37;2348,76;2348,76\n" +
+		"Tesouro IPCA+;15/05/2035;23/12/2025;7,29;abc;2374,37;2348,76;2348,76\n" +
+		"Tesouro Selic;17/03/2010;22/12/2025;0,00;0,03;3185,95;3183,49;3182,12\n"
+
+	var p csvParser
+	latest, err := p.parse(strings.NewReader(csv))
+	require.NoError(t, err)
+	assert.Len(t, latest, 2)
+
+	assert.Equal(t, 5, p.report.RowsRead)
+	assert.Equal(t, 2, p.report.RowsParsed)
+	assert.Equal(t, 2, p.report.RowsSkipped)
+	assert.Equal(t, 1, p.report.RowsShort)
+
+	require.Len(t, p.report.Warnings, 3)
+	assert.Equal(t, parseDiagnostic{
+		Line:    3,
+		Raw:     "Tesouro IPCA+;15/05/2035",
+		Kind:    diagShortRow,
+		Message: "expected 8 fields, got 2",
+	}, p.report.Warnings[0])
+
+	assert.Equal(t, 4, p.report.Warnings[1].Line)
+	assert.Equal(t, "Data Base", p.report.Warnings[1].Column)
+	assert.Equal(t, "31/02/2025", p.report.Warnings[1].Raw)
+	assert.Equal(t, diagInvalidDate, p.report.Warnings[1].Kind)
+
+	assert.Equal(t, 5, p.report.Warnings[2].Line)
+	assert.Equal(t, "Taxa Venda Manha", p.report.Warnings[2].Column)
+	assert.Equal(t, "abc", p.report.Warnings[2].Raw)
+	assert.Equal(t, diagInvalidNumber, p.report.Warnings[2].Kind)
+}
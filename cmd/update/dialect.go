@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// csvDialect controls how writeCSV formats a file.
+type csvDialect struct {
+	comma      rune           // Field delimiter
+	decimal    string         // Decimal separator for numbers
+	dateLayout string         // Go time layout for dates
+	lang       string         // Header language: "pt" or "en"
+	decimals   map[string]int // Optional fixed number of decimals, keyed by column
+}
+
+// csvOutput is a CSV file published with a given dialect.
+type csvOutput struct {
+	file    string
+	dialect csvDialect
+}
+
+var (
+	dialectPTBR = csvDialect{comma: ';', decimal: ",", dateLayout: "2006-01-02", lang: "pt"}
+	dialectEN   = csvDialect{comma: ',', decimal: ".", dateLayout: "2006-01-02", lang: "en"}
+)
+
+// defaultCSVOutputs are always published.
+var defaultCSVOutputs = []csvOutput{
+	{file: "latest.csv", dialect: dialectPTBR},
+	{file: "latest.en.csv", dialect: dialectEN},
+}
+
+// reservedOutputNames are the files and directories published at the top of
+// the output directory, which an extra CSV output must not replace.
+var reservedOutputNames = map[string]bool{
+	"latest.json": true, "latest.csv": true, "latest.en.csv": true, "latest.xml": true,
+	"latest.ndjson": true, "history.ndjson": true,
+	"anomalies.json": true, rejectedFile: true, "run.json": true, "health.json": true, "revisions.json": true, "manifest.json": true,
+	"tesouro.xlsx": true, "tesouro.sqlite": true,
+	checksumsFile: true, signatureFile: true,
+	"v2": true, "bonds": true, "familias": true, "xml": true, "v": true, "parquet": true, "schema": true,
+}
+
+// checkOutputFile accepts a bare file name that does not clash with another
+// output or with the compressed and temporary variants of outputs.
+func checkOutputFile(name string) error {
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid file %q: expected a file name without directories", name)
+	}
+	if reservedOutputNames[name] {
+		return fmt.Errorf("invalid file %q: already a published output", name)
+	}
+	for _, ext := range []string{".gz", ".br", ".tmp"} {
+		if strings.HasSuffix(name, ext) {
+			return fmt.Errorf("invalid file %q: %s is reserved for generated variants", name, ext)
+		}
+	}
+	return nil
+}
+
+const (
+	columnText = iota
+	columnDate
+	columnNumber
+)
+
+// csvColumns lists the CSV columns in order. The key matches the JSON field
+// name and is used to configure per-column decimals.
+var csvColumns = []struct {
+	key  string
+	pt   string
+	en   string
+	kind int
+	text func(Record) string
+	num  func(Record) float64
+}{
+	{key: "nome", pt: "Nome", en: "Name", kind: columnText, text: func(r Record) string { return r.Nome }},
+	{key: "data_inicio", pt: "Data Inicio", en: "Start Date", kind: columnDate, text: func(r Record) string { return r.DataInicio }},
+	{key: "data_conversao", pt: "Data Conversao", en: "Conversion Date", kind: columnDate, text: func(r Record) string { return r.DataConversao }},
+	{key: "data_vencimento", pt: "Data Vencimento", en: "Maturity Date", kind: columnDate, text: func(r Record) string { return r.DataVencimento }},
+	{key: "data_base", pt: "Data Base", en: "Base Date", kind: columnDate, text: func(r Record) string { return r.DataBase }},
+	{key: "taxa_compra_manha", pt: "Taxa Compra Manha", en: "Morning Buy Rate", kind: columnNumber, num: func(r Record) float64 { return r.TaxaCompraManha }},
+	{key: "taxa_venda_manha", pt: "Taxa Venda Manha", en: "Morning Sell Rate", kind: columnNumber, num: func(r Record) float64 { return r.TaxaVendaManha }},
+	{key: "pu_compra_manha", pt: "PU Compra Manha", en: "Morning Buy Price", kind: columnNumber, num: func(r Record) float64 { return r.PUCompraManha }},
+	{key: "pu_venda_manha", pt: "PU Venda Manha", en: "Morning Sell Price", kind: columnNumber, num: func(r Record) float64 { return r.PUVendaManha }},
+	{key: "pu_base_manha", pt: "PU Base Manha", en: "Morning Base Price", kind: columnNumber, num: func(r Record) float64 { return r.PUBaseManha }},
+}
+
+func (d csvDialect) header() []string {
+	header := make([]string, len(csvColumns))
+	for i, col := range csvColumns {
+		if d.lang == "en" {
+			header[i] = col.en
+		} else {
+			header[i] = col.pt
+		}
+	}
+	return header
+}
+
+func (d csvDialect) row(rec Record) []string {
+	row := make([]string, len(csvColumns))
+	for i, col := range csvColumns {
+		switch col.kind {
+		case columnText:
+			row[i] = col.text(rec)
+		case columnDate:
+			row[i] = d.formatDate(col.text(rec))
+		case columnNumber:
+			row[i] = d.formatFloat(col.key, col.num(rec))
+		}
+	}
+	return row
+}
+
+func (d csvDialect) formatDate(iso string) string {
+	if iso == "" || d.dateLayout == "2006-01-02" {
+		return iso
+	}
+	t, err := time.Parse("2006-01-02", iso)
+	if err != nil {
+		return iso
+	}
+	return t.Format(d.dateLayout)
+}
+
+func (d csvDialect) formatFloat(column string, f float64) string {
+	prec := -1
+	if n, ok := d.decimals[column]; ok {
+		prec = n
+	}
+	s := strconv.FormatFloat(f, 'f', prec, 64)
+	if d.decimal != "." {
+		s = strings.ReplaceAll(s, ".", d.decimal)
+	}
+	return s
+}
+
+// dateLayouts maps the date formats accepted on the command line to Go layouts.
+var dateLayouts = map[string]string{
+	"yyyy-mm-dd": "2006-01-02",
+	"dd/mm/yyyy": "02/01/2006",
+	"mm/dd/yyyy": "01/02/2006",
+	"dd.mm.yyyy": "02.01.2006",
+}
+
+// delimiterNames lets delimiters that clash with the spec syntax be named.
+var delimiterNames = map[string]rune{
+	"comma":     ',',
+	"semicolon": ';',
+	"tab":       '\t',
+	"pipe":      '|',
+}
+
+// validDelimiter reports whether csv.Writer accepts r as a field delimiter,
+// so a bad one fails at flag parsing rather than in the middle of a publish.
+func validDelimiter(r rune) bool {
+	return r != 0 && r != '"' && r != '\r' && r != '\n' && utf8.ValidRune(r) && r != utf8.RuneError
+}
+
+// parseCSVOutput parses an extra CSV output spec of the form
+// "file=latest.us.csv,delimiter=comma,decimal=.,date=mm/dd/yyyy,lang=en".
+// Unset keys default to the PT-BR dialect.
+func parseCSVOutput(spec string) (csvOutput, error) {
+	out := csvOutput{dialect: dialectPTBR}
+	for _, part := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return out, fmt.Errorf("invalid CSV option %q: expected key=value", part)
+		}
+		switch key {
+		case "file":
+			out.file = value
+		case "delimiter":
+			if r, ok := delimiterNames[value]; ok {
+				out.dialect.comma = r
+			} else if runes := []rune(value); len(runes) == 1 {
+				out.dialect.comma = runes[0]
+			} else {
+				return out, fmt.Errorf("invalid delimiter %q", value)
+			}
+			if !validDelimiter(out.dialect.comma) {
+				return out, fmt.Errorf("invalid delimiter %q: csv cannot write it", value)
+			}
+		case "decimal":
+			if value != "." && value != "," {
+				return out, fmt.Errorf("invalid decimal separator %q: expected . or ,", value)
+			}
+			out.dialect.decimal = value
+		case "date":
+			layout, ok := dateLayouts[value]
+			if !ok {
+				return out, fmt.Errorf("invalid date format %q", value)
+			}
+			out.dialect.dateLayout = layout
+		case "lang":
+			if value != "pt" && value != "en" {
+				return out, fmt.Errorf("invalid header language %q: expected pt or en", value)
+			}
+			out.dialect.lang = value
+		default:
+			return out, fmt.Errorf("unknown CSV option %q", key)
+		}
+	}
+	if out.file == "" {
+		return out, fmt.Errorf("missing file in CSV spec %q", spec)
+	}
+	if err := checkOutputFile(out.file); err != nil {
+		return out, err
+	}
+	if string(out.dialect.comma) == out.dialect.decimal {
+		return out, fmt.Errorf("delimiter and decimal separator are both %q", out.dialect.decimal)
+	}
+	return out, nil
+}
+
+// parseDecimals parses "taxa_compra_manha=2,pu_base_manha=6" into a map of
+// fixed decimals per numeric column.
+func parseDecimals(spec string) (map[string]int, error) {
+	decimals := map[string]int{}
+	if spec == "" {
+		return decimals, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid decimals %q: expected column=n", part)
+		}
+		if !isNumberColumn(key) {
+			return nil, fmt.Errorf("unknown numeric column %q", key)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid decimals for %s: %q", key, value)
+		}
+		decimals[key] = n
+	}
+	return decimals, nil
+}
+
+func isNumberColumn(key string) bool {
+	for _, col := range csvColumns {
+		if col.key == key && col.kind == columnNumber {
+			return true
+		}
+	}
+	return false
+}
+
+// spec formats the output as a --csv spec that parseCSVOutput reads back.
+func (o csvOutput) spec() string {
+	delimiter := string(o.dialect.comma)
+	for name, r := range delimiterNames {
+		if r == o.dialect.comma {
+			delimiter = name
+		}
+	}
+	date := "yyyy-mm-dd"
+	for name, layout := range dateLayouts {
+		if layout == o.dialect.dateLayout {
+			date = name
+		}
+	}
+	spec := fmt.Sprintf("file=%s,delimiter=%s,date=%s,lang=%s", o.file, delimiter, date, o.dialect.lang)
+	// A comma cannot be written in a spec, but it is the default
+	if o.dialect.decimal != "," {
+		spec += ",decimal=" + o.dialect.decimal
+	}
+	return spec
+}
+
+// formatDecimals is the inverse of parseDecimals, with columns sorted.
+func formatDecimals(decimals map[string]int) string {
+	parts := make([]string, 0, len(decimals))
+	for key, n := range decimals {
+		parts = append(parts, fmt.Sprintf("%s=%d", key, n))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// csvOutputFlag collects repeated --csv flags.
+type csvOutputFlag []csvOutput
+
+func (f *csvOutputFlag) String() string {
+	files := make([]string, len(*f))
+	for i, out := range *f {
+		files[i] = out.file
+	}
+	return strings.Join(files, ",")
+}
+
+func (f *csvOutputFlag) Set(spec string) error {
+	out, err := parseCSVOutput(spec)
+	if err != nil {
+		return err
+	}
+	for _, other := range *f {
+		if other.file == out.file {
+			return fmt.Errorf("file %q is given twice", out.file)
+		}
+	}
+	*f = append(*f, out)
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCSVDialect(t *testing.T) {
+	records := []Record{{
+		Nome:            "Tesouro IPCA+ 2035",
+		DataInicio:      "2024-12-22",
+		DataVencimento:  "2035-05-15",
+		DataBase:        "2025-12-22",
+		TaxaCompraManha: 7.29,
+		TaxaVendaManha:  7.41,
+		PUCompraManha:   2374.37,
+		PUVendaManha:    2348.76,
+		PUBaseManha:     2348.7612,
+	}}
+
+	tests := []struct {
+		name    string
+		dialect csvDialect
+		want    string
+	}{
+		{
+			name:    "PT-BR",
+			dialect: dialectPTBR,
+			want: "Nome;Data Inicio;Data Conversao;Data Vencimento;Data Base;Taxa Compra Manha;Taxa Venda Manha;PU Compra Manha;PU Venda Manha;PU Base Manha\n" +
+				"Tesouro IPCA+ 2035;2024-12-22;;2035-05-15;2025-12-22;7,29;7,41;2374,37;2348,76;2348,7612\n",
+		},
+		{
+			name:    "English",
+			dialect: dialectEN,
+			want: "Name,Start Date,Conversion Date,Maturity Date,Base Date,Morning Buy Rate,Morning Sell Rate,Morning Buy Price,Morning Sell Price,Morning Base Price\n" +
+				"Tesouro IPCA+ 2035,2024-12-22,,2035-05-15,2025-12-22,7.29,7.41,2374.37,2348.76,2348.7612\n",
+		},
+		{
+			name: "custom date format and fixed decimals",
+			dialect: csvDialect{comma: '\t', decimal: ",", dateLayout: "02/01/2006", lang: "pt", decimals: map[string]int{
+				"taxa_compra_manha": 4,
+				"pu_base_manha":     2,
+			}},
+			want: "Nome\tData Inicio\tData Conversao\tData Vencimento\tData Base\tTaxa Compra Manha\tTaxa Venda Manha\tPU Compra Manha\tPU Venda Manha\tPU Base Manha\n" +
+				"Tesouro IPCA+ 2035\t22/12/2024\t\t15/05/2035\t22/12/2025\t7,2900\t7,41\t2374,37\t2348,76\t2348,76\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "latest.csv")
+			require.NoError(t, writeCSVDialect(records, path, tt.dialect))
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(data))
+		})
+	}
+}
+
+func TestParseCSVOutput(t *testing.T) {
+	out, err := parseCSVOutput("file=latest.us.csv,delimiter=comma,decimal=.,date=mm/dd/yyyy,lang=en")
+	require.NoError(t, err)
+	assert.Equal(t, "latest.us.csv", out.file)
+	assert.Equal(t, ',', out.dialect.comma)
+	assert.Equal(t, ".", out.dialect.decimal)
+	assert.Equal(t, "01/02/2006", out.dialect.dateLayout)
+	assert.Equal(t, "en", out.dialect.lang)
+
+	// Unset keys default to PT-BR
+	out, err = parseCSVOutput("file=latest.pipe.csv,delimiter=|")
+	require.NoError(t, err)
+	assert.Equal(t, '|', out.dialect.comma)
+	assert.Equal(t, ",", out.dialect.decimal)
+
+	// spec reads back as the same output
+	for _, spec := range []string{"file=a.csv,delimiter=tab,date=dd.mm.yyyy", "file=b.csv,delimiter=:,decimal=.,lang=en"} {
+		out, err := parseCSVOutput(spec)
+		require.NoError(t, err)
+		again, err := parseCSVOutput(out.spec())
+		require.NoError(t, err, out.spec())
+		assert.Equal(t, out, again)
+	}
+
+	for _, spec := range []string{
+		"delimiter=comma",
+		"file=x.csv,delimiter=ab",
+		`file=x.csv,delimiter="`,
+		"file=x.csv,delimiter=\r",
+		"file=x.csv,delimiter=\n",
+		"file=x.csv,delimiter=\x00",
+		"file=x.csv,delimiter=\uFFFD",
+		"file=x.csv,delimiter=\xff",
+		"file=x.csv,decimal=;",
+		"file=x.csv,date=yyyy",
+		"file=x.csv,lang=fr",
+		"file=x.csv,color=red",
+		"file=x.csv,delimiter=comma,decimal=,",
+		"file",
+		"file=../x.csv",
+		"file=sub/x.csv",
+		"file=/tmp/x.csv",
+		"file=..",
+		"file=latest.csv",
+		"file=latest.json",
+		"file=SHA256SUMS",
+		"file=schema",
+		"file=x.csv.gz",
+	} {
+		_, err := parseCSVOutput(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestParseDecimals(t *testing.T) {
+	decimals, err := parseDecimals("taxa_compra_manha=2,pu_base_manha=6")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"taxa_compra_manha": 2, "pu_base_manha": 6}, decimals)
+
+	decimals, err = parseDecimals("")
+	require.NoError(t, err)
+	assert.Empty(t, decimals)
+
+	decimals, err = parseDecimals(formatDecimals(map[string]int{"pu_base_manha": 6, "taxa_compra_manha": 2}))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"taxa_compra_manha": 2, "pu_base_manha": 6}, decimals)
+
+	for _, spec := range []string{"nome=2", "taxa_compra_manha=-1", "taxa_compra_manha", "taxa_compra_manha=x"} {
+		_, err := parseDecimals(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestCSVHeaderMatchesXLSX(t *testing.T) {
+	header := dialectPTBR.header()
+	require.Len(t, header, len(xlsxColumns))
+	for i, col := range xlsxColumns {
+		assert.Equal(t, col.header, header[i])
+	}
+	assert.True(t, strings.HasPrefix(strings.Join(dialectEN.header(), ","), "Name,"))
+}
@@ -1,31 +1,329 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
-func downloadCSV(url string) (*http.Response, error) {
-	client := &http.Client{
-		Timeout: 60 * time.Second,
+const (
+	defaultRetries    = 4
+	defaultRetryDelay = 2 * time.Second
+	defaultTimeout    = 60 * time.Second
+
+	// maxRetryDelay caps the exponential backoff
+	maxRetryDelay = time.Minute
+
+	userAgent = "tesouro-api-updater/1.0"
+)
+
+// source is the upstream CSV body with what is known about it.
+type source struct {
+	body         io.ReadCloser
+	sha256       string // Hex SHA-256 of the body, when known before reading it
+	lastModified string // Upstream Last-Modified as RFC 3339, UTC
+	etag         string
+	cacheHit     bool // The cached copy was reused (304, or a body identical to the cache)
+	incremental  bool // Assembled from the cached copy plus appended bytes, not downloaded in full
+}
+
+// openSource fetches the upstream CSV, through the raw cache when cacheDir
+// is set.
+func openSource(f *fetcher, url, cacheDir string) (source, error) {
+	if cacheDir != "" {
+		return rawCache{dir: cacheDir}.fetch(f, url)
+	}
+
+	resp, err := f.download(url, nil)
+	if err != nil {
+		return source{}, err
+	}
+	return source{
+		body:         resp.Body,
+		lastModified: formatLastModified(resp.Header.Get("Last-Modified")),
+		etag:         resp.Header.Get("ETag"),
+	}, nil
+}
+
+// fetcher downloads over HTTP, retrying transient failures with jittered
+// exponential backoff and resuming interrupted bodies with Range requests.
+type fetcher struct {
+	client    *http.Client
+	retries   int                 // Retries after the first attempt
+	baseDelay time.Duration       // Delay before the first retry, doubled on each one
+	sleep     func(time.Duration) // Replaced in tests
+}
+
+// newFetcher returns a fetcher whose attempts each time out after timeout
+// (0 disables).
+func newFetcher(timeout time.Duration, retries int, baseDelay time.Duration) *fetcher {
+	return &fetcher{
+		client:    &http.Client{Timeout: timeout},
+		retries:   retries,
+		baseDelay: baseDelay,
+		sleep:     time.Sleep,
+	}
+}
+
+// statusError is a response status the caller did not expect.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.code)
+}
+
+// download requests url. When cached is set, the request is conditional on
+// its ETag and Last-Modified, and a 304 response is returned as is. The body
+// of a 200 response resumes from where it stopped if the connection drops,
+// and fails if it ends short of its Content-Length.
+func (f *fetcher) download(url string, cached *cacheMeta) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("User-Agent", userAgent)
+
+	conditional := header.Clone()
+	if cached != nil {
+		if cached.ETag != "" {
+			conditional.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			conditional.Set("If-Modified-Since", cached.LastModified)
+		}
 	}
 
+	resp, err := f.do(url, conditional)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &statusError{resp.StatusCode}
+	}
+	if err := checkContentType(resp.Header); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	resp.Body = &resumableBody{
+		f:            f,
+		url:          url,
+		header:       header,
+		body:         resp.Body,
+		size:         resp.ContentLength,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+	return resp, nil
+}
+
+// do sends a GET request, retrying network errors, 5xx and 429 responses.
+func (f *fetcher) do(url string, header http.Header) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := f.attempt(url, header)
+		if err == nil {
+			return resp, nil
+		}
+		if attempt >= f.retries || !retryable(err) {
+			return nil, err
+		}
+
+		delay := f.backoff(attempt)
+		fmt.Fprintf(os.Stderr, "Warning: download attempt %d failed (%v), retrying in %s\n", attempt+1, err, delay.Round(time.Millisecond))
+		f.sleep(delay)
+	}
+}
+
+func (f *fetcher) attempt(url string, header http.Header) (*http.Response, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("User-Agent", "tesouro-api-updater/1.0")
+	req.Header = header.Clone()
 
-	resp, err := client.Do(req)
+	resp, err := f.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		resp.Body.Close()
+		return nil, &statusError{resp.StatusCode}
+	}
+	return resp, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
+// backoff returns the delay before retry number attempt+1: the base delay
+// doubled attempt times, capped, with the upper half randomized so that
+// clients failing together do not retry together.
+func (f *fetcher) backoff(attempt int) time.Duration {
+	delay := f.baseDelay << attempt
+	if delay > maxRetryDelay || delay <= 0 {
+		delay = maxRetryDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// checkContentType rejects a response that is clearly not the CSV, such as an
+// HTML error page sent with status 200. A missing Content-Type is accepted.
+func checkContentType(header http.Header) error {
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid Content-Type %q: %w", contentType, err)
+	}
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "application/json":
+		return fmt.Errorf("unexpected Content-Type %q: expected a CSV file", contentType)
+	}
+	return nil
+}
+
+// contentRangeTotal returns the complete length in a Content-Range header,
+// or -1 when it is unknown.
+func contentRangeTotal(contentRange string) int64 {
+	_, total, ok := strings.Cut(contentRange, "/")
+	if !ok {
+		return -1
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// retryable reports whether err is worth another attempt: a server error,
+// rate limiting, a timeout, or a dropped connection.
+func retryable(err error) bool {
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code >= 500 || status.code == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// resumableBody reads a response body and, when the transfer breaks, requests
+// the rest with a Range request.
+type resumableBody struct {
+	f            *fetcher
+	url          string
+	header       http.Header // Request headers, without Range or conditionals
+	body         io.ReadCloser
+	size         int64 // Content-Length of the whole body, -1 when unknown
+	read         int64 // Bytes delivered so far
+	resumes      int
+	etag         string
+	lastModified string
+}
+
+func (b *resumableBody) Read(p []byte) (int, error) {
+	for {
+		n, err := b.body.Read(p)
+		b.read += int64(n)
+		if err == io.EOF && b.size >= 0 && b.read != b.size {
+			return n, fmt.Errorf("download truncated: read %d of %d bytes", b.read, b.size)
+		}
+		if err == nil || err == io.EOF || !retryable(err) {
+			return n, err
+		}
+		if rerr := b.resume(err); rerr != nil {
+			return n, rerr
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (b *resumableBody) Close() error {
+	return b.body.Close()
+}
+
+// resume replaces the broken body with one starting at the next unread byte.
+// If-Range makes the server send the whole file instead when it changed.
+func (b *resumableBody) resume(cause error) error {
+	b.body.Close()
+	if b.resumes >= b.f.retries {
+		return fmt.Errorf("download interrupted after %d bytes: %w", b.read, cause)
+	}
+	delay := b.f.backoff(b.resumes)
+	b.resumes++
+	fmt.Fprintf(os.Stderr, "Warning: download interrupted after %d bytes (%v), resuming in %s\n", b.read, cause, delay.Round(time.Millisecond))
+	b.f.sleep(delay)
+
+	header := b.header.Clone()
+	header.Set("Range", fmt.Sprintf("bytes=%d-", b.read))
+	if validator := b.validator(); validator != "" {
+		header.Set("If-Range", validator)
+	}
+	resp, err := b.f.do(b.url, header)
+	if err != nil {
+		return fmt.Errorf("failed to resume download: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", b.read)) {
+			resp.Body.Close()
+			return fmt.Errorf("failed to resume download: unexpected Content-Range %q", resp.Header.Get("Content-Range"))
+		}
+	case http.StatusOK:
+		// The server ignored the range. Its answer is only a continuation
+		// when it is the same file, in which case the known prefix is skipped.
+		if b.validator() == "" || resp.Header.Get("ETag") != b.etag || resp.Header.Get("Last-Modified") != b.lastModified {
+			resp.Body.Close()
+			return fmt.Errorf("failed to resume download: upstream file changed or cannot be resumed")
+		}
+		if _, err := io.CopyN(io.Discard, resp.Body, b.read); err != nil {
+			resp.Body.Close()
+			return fmt.Errorf("failed to resume download: %w", err)
+		}
+	default:
 		resp.Body.Close()
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return fmt.Errorf("failed to resume download: %w", &statusError{resp.StatusCode})
 	}
 
-	return resp, nil
+	b.body = resp.Body
+	return nil
+}
+
+// validator returns the If-Range value: the ETag when it is strong, otherwise
+// the Last-Modified date.
+func (b *resumableBody) validator() string {
+	if b.etag != "" && !strings.HasPrefix(b.etag, "W/") {
+		return b.etag
+	}
+	return b.lastModified
+}
+
+// formatLastModified converts an HTTP date to RFC 3339 in UTC. Missing and
+// unparseable dates give an empty string.
+func formatLastModified(header string) string {
+	t, err := http.ParseTime(header)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
 }
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyServer serves body, failing requests according to plan: each entry
+// handles one request, and requests beyond the plan are served normally.
+type flakyServer struct {
+	mu       sync.Mutex
+	body     []byte
+	plan     []func(w http.ResponseWriter, r *http.Request) bool
+	requests []*http.Request
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	n := len(s.requests)
+	s.requests = append(s.requests, r)
+	var step func(w http.ResponseWriter, r *http.Request) bool
+	if n < len(s.plan) {
+		step = s.plan[n]
+	}
+	s.mu.Unlock()
+
+	if step != nil && step(w, r) {
+		return
+	}
+	w.Header().Set("ETag", `"v1"`)
+	http.ServeContent(w, r, "", time.Date(2025, 12, 22, 18, 30, 0, 0, time.UTC), bytes.NewReader(s.body))
+}
+
+// failWith answers with a status code.
+func failWith(code int) func(w http.ResponseWriter, r *http.Request) bool {
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		w.WriteHeader(code)
+		return true
+	}
+}
+
+// truncateAfter sends the headers of the full body, then drops the
+// connection after n bytes. It also serves Range requests that way.
+func truncateAfter(n int) func(w http.ResponseWriter, r *http.Request) bool {
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 22 Dec 2025 18:30:00 GMT")
+		w.Header().Set("Content-Length", "100000")
+		w.WriteHeader(http.StatusOK)
+		w.Write(bytes.Repeat([]byte("x"), n))
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func newTestFetcher(retries int) (*fetcher, *[]time.Duration) {
+	var delays []time.Duration
+	f := newFetcher(5*time.Second, retries, 100*time.Millisecond)
+	f.sleep = func(d time.Duration) { delays = append(delays, d) }
+	return f, &delays
+}
+
+func fetchAll(f *fetcher, url string) (string, error) {
+	resp, err := f.download(url, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return string(data), err
+}
+
+func TestFetcherRetries(t *testing.T) {
+	body := strings.Repeat("Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n", 100)
+
+	t.Run("server errors", func(t *testing.T) {
+		s := &flakyServer{body: []byte(body), plan: []func(http.ResponseWriter, *http.Request) bool{
+			failWith(http.StatusServiceUnavailable),
+			failWith(http.StatusBadGateway),
+		}}
+		srv := httptest.NewServer(s)
+		defer srv.Close()
+		f, delays := newTestFetcher(3)
+
+		data, err := fetchAll(f, srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, body, data)
+		assert.Len(t, s.requests, 3)
+		require.Len(t, *delays, 2)
+		assert.GreaterOrEqual(t, (*delays)[1], 100*time.Millisecond, "the second delay should have doubled")
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		s := &flakyServer{body: []byte(body), plan: []func(http.ResponseWriter, *http.Request) bool{
+			failWith(http.StatusInternalServerError),
+			failWith(http.StatusInternalServerError),
+			failWith(http.StatusInternalServerError),
+		}}
+		srv := httptest.NewServer(s)
+		defer srv.Close()
+		f, _ := newTestFetcher(2)
+
+		_, err := fetchAll(f, srv.URL)
+		assert.ErrorContains(t, err, "unexpected status code: 500")
+		assert.Len(t, s.requests, 3)
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		s := &flakyServer{body: []byte(body), plan: []func(http.ResponseWriter, *http.Request) bool{
+			failWith(http.StatusNotFound),
+		}}
+		srv := httptest.NewServer(s)
+		defer srv.Close()
+		f, _ := newTestFetcher(3)
+
+		_, err := fetchAll(f, srv.URL)
+		assert.ErrorContains(t, err, "unexpected status code: 404")
+		assert.Len(t, s.requests, 1)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		s := &flakyServer{body: []byte(body), plan: []func(http.ResponseWriter, *http.Request) bool{
+			func(w http.ResponseWriter, r *http.Request) bool {
+				time.Sleep(300 * time.Millisecond)
+				return true
+			},
+		}}
+		srv := httptest.NewServer(s)
+		defer srv.Close()
+		f, _ := newTestFetcher(1)
+		f.client.Timeout = 100 * time.Millisecond
+
+		data, err := fetchAll(f, srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, body, data)
+	})
+
+	t.Run("resumes with range", func(t *testing.T) {
+		s := &flakyServer{body: []byte(body)}
+		s.plan = []func(http.ResponseWriter, *http.Request) bool{
+			func(w http.ResponseWriter, r *http.Request) bool {
+				// Headers of the real body, cut after 1000 bytes
+				w.Header().Set("ETag", `"v1"`)
+				w.Header().Set("Content-Length", strconv.Itoa(len(s.body)))
+				w.WriteHeader(http.StatusOK)
+				w.Write(s.body[:1000])
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			},
+		}
+		srv := httptest.NewServer(s)
+		defer srv.Close()
+		f, _ := newTestFetcher(2)
+
+		data, err := fetchAll(f, srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, body, data)
+		require.Len(t, s.requests, 2)
+		assert.Equal(t, "bytes=1000-", s.requests[1].Header.Get("Range"))
+		assert.Equal(t, `"v1"`, s.requests[1].Header.Get("If-Range"))
+	})
+
+	t.Run("resume without range support", func(t *testing.T) {
+		s := &flakyServer{body: []byte(body)}
+		s.plan = []func(http.ResponseWriter, *http.Request) bool{
+			func(w http.ResponseWriter, r *http.Request) bool {
+				w.Header().Set("ETag", `"v1"`)
+				w.Header().Set("Content-Length", strconv.Itoa(len(s.body)))
+				w.WriteHeader(http.StatusOK)
+				w.Write(s.body[:1000])
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			},
+			func(w http.ResponseWriter, r *http.Request) bool {
+				// Ignores Range, but it is the same file
+				w.Header().Set("ETag", `"v1"`)
+				w.Write(s.body)
+				return true
+			},
+		}
+		srv := httptest.NewServer(s)
+		defer srv.Close()
+		f, _ := newTestFetcher(2)
+
+		data, err := fetchAll(f, srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, body, data)
+	})
+
+	t.Run("file changed while resuming", func(t *testing.T) {
+		s := &flakyServer{body: []byte(body), plan: []func(http.ResponseWriter, *http.Request) bool{
+			truncateAfter(1000),
+			func(w http.ResponseWriter, r *http.Request) bool {
+				w.Header().Set("ETag", `"v2"`)
+				w.Write([]byte(body))
+				return true
+			},
+		}}
+		srv := httptest.NewServer(s)
+		defer srv.Close()
+		f, _ := newTestFetcher(2)
+
+		_, err := fetchAll(f, srv.URL)
+		assert.ErrorContains(t, err, "upstream file changed")
+	})
+
+	t.Run("resumed body shorter than announced", func(t *testing.T) {
+		s := &flakyServer{body: []byte(body)}
+		s.plan = []func(http.ResponseWriter, *http.Request) bool{
+			truncateAfter(1000),
+			func(w http.ResponseWriter, r *http.Request) bool {
+				// A complete 206 that stops before the end of the file
+				w.Header().Set("Content-Range", "bytes 1000-1999/100000")
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(s.body[1000:2000])
+				return true
+			},
+		}
+		srv := httptest.NewServer(s)
+		defer srv.Close()
+		f, _ := newTestFetcher(2)
+
+		_, err := fetchAll(f, srv.URL)
+		assert.ErrorContains(t, err, "download truncated: read 2000 of 100000 bytes")
+	})
+
+	t.Run("HTML error page", func(t *testing.T) {
+		s := &flakyServer{body: []byte(body), plan: []func(http.ResponseWriter, *http.Request) bool{
+			func(w http.ResponseWriter, r *http.Request) bool {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.Write([]byte("<html><body>Manutenção</body></html>"))
+				return true
+			},
+		}}
+		srv := httptest.NewServer(s)
+		defer srv.Close()
+		f, _ := newTestFetcher(2)
+
+		_, err := fetchAll(f, srv.URL)
+		assert.ErrorContains(t, err, `unexpected Content-Type "text/html; charset=utf-8"`)
+		assert.Len(t, s.requests, 1, "not retried")
+	})
+
+	t.Run("too many interruptions", func(t *testing.T) {
+		s := &flakyServer{body: []byte(body), plan: []func(http.ResponseWriter, *http.Request) bool{
+			truncateAfter(10),
+			truncateAfter(10),
+		}}
+		srv := httptest.NewServer(s)
+		defer srv.Close()
+		f, _ := newTestFetcher(1)
+
+		_, err := fetchAll(f, srv.URL)
+		assert.ErrorContains(t, err, "download interrupted")
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	f := newFetcher(0, 10, time.Second)
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		for i := 0; i < 20; i++ {
+			d := f.backoff(attempt)
+			assert.GreaterOrEqual(t, d, max/2)
+			assert.LessOrEqual(t, d, max)
+		}
+	}
+	assert.LessOrEqual(t, f.backoff(30), maxRetryDelay)
+}
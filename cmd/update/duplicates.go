@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Policies for rows that share a bond and Data Base (--duplicates)
+const (
+	duplicatesFirst   = "first"
+	duplicatesLast    = "last"
+	duplicatesAverage = "average"
+	duplicatesError   = "error"
+)
+
+func validDuplicatesPolicy(policy string) bool {
+	switch policy {
+	case duplicatesFirst, duplicatesLast, duplicatesAverage, duplicatesError:
+		return true
+	}
+	return false
+}
+
+// duplicateRow reports a row whose bond and Data Base were already seen with
+// different values.
+type duplicateRow struct {
+	Nome           string    `json:"nome"`
+	TipoTitulo     string    `json:"tipo_titulo"`
+	DataVencimento string    `json:"data_vencimento" schema:"date"`
+	DataBase       string    `json:"data_base" schema:"date"`
+	FirstLine      int       `json:"first_line"` // Line of the first row for this bond and Data Base
+	KeptLine       int       `json:"kept_line"`  // Line of the row kept before this one, which it conflicts with
+	Line           int       `json:"line"`
+	FirstValues    rowValues `json:"first_values"`
+	KeptValues     rowValues `json:"kept_values"` // Values kept before this row; an average under that policy
+	Values         rowValues `json:"values"`
+	Policy         string    `json:"policy"` // How the conflict was resolved
+}
+
+// seenRow tracks the rows parsed for one bond and Data Base.
+type seenRow struct {
+	line     int         // Line of the first row
+	keptLine int         // Line of the row that last changed the kept values
+	index    int         // Position of the kept row in the asset's history
+	distinct []rowValues // Distinct values seen, first one first
+}
+
+func newSeenRow(rec Record, line, index int) *seenRow {
+	return &seenRow{line: line, keptLine: line, index: index, distinct: []rowValues{*newRowValues(rec)}}
+}
+
+// known reports whether values were already seen.
+func (s *seenRow) known(values rowValues) bool {
+	for _, v := range s.distinct {
+		if v == values {
+			return true
+		}
+	}
+	return false
+}
+
+// average is the mean of the distinct values seen.
+func (s *seenRow) average() rowValues {
+	var sum rowValues
+	for _, v := range s.distinct {
+		sum.TaxaCompraManha += v.TaxaCompraManha
+		sum.TaxaVendaManha += v.TaxaVendaManha
+		sum.PUCompraManha += v.PUCompraManha
+		sum.PUVendaManha += v.PUVendaManha
+		sum.PUBaseManha += v.PUBaseManha
+	}
+	n := float64(len(s.distinct))
+	return rowValues{
+		TaxaCompraManha: sum.TaxaCompraManha / n,
+		TaxaVendaManha:  sum.TaxaVendaManha / n,
+		PUCompraManha:   sum.PUCompraManha / n,
+		PUVendaManha:    sum.PUVendaManha / n,
+		PUBaseManha:     sum.PUBaseManha / n,
+	}
+}
+
+// resolveDuplicate applies the duplicates policy to rec, a later row for the
+// same bond and Data Base as seen. It returns the row to keep in place of
+// kept, and whether its values changed. Rows repeating values already seen
+// are dropped, except under the last policy when they differ from the kept
+// row, which they then replace.
+func (p *csvParser) resolveDuplicate(seen *seenRow, kept, rec Record, line int) (Record, bool, error) {
+	policy := p.duplicates
+	if policy == "" {
+		policy = duplicatesLast
+	}
+	p.report.RowsDuplicate++
+
+	values := *newRowValues(rec)
+	keptValues := *newRowValues(kept)
+	known := seen.known(values)
+	if known && (policy != duplicatesLast || values == keptValues) {
+		return kept, false, nil
+	}
+	if !known {
+		seen.distinct = append(seen.distinct, values)
+	}
+
+	if policy == duplicatesError {
+		return kept, false, fmt.Errorf("line %d: %s on %s conflicts with line %d", line, rec.Nome, rec.DataBase, seen.line)
+	}
+	if !p.report.quiet {
+		fmt.Fprintf(os.Stderr, "Warning: line %d: %s on %s conflicts with line %d, keeping the %s\n", line, rec.Nome, rec.DataBase, seen.keptLine, policy)
+	}
+	p.report.Duplicates = append(p.report.Duplicates, duplicateRow{
+		Nome:           rec.Nome,
+		TipoTitulo:     rec.tipoTitulo,
+		DataVencimento: rec.DataVencimento,
+		DataBase:       rec.DataBase,
+		FirstLine:      seen.line,
+		KeptLine:       seen.keptLine,
+		Line:           line,
+		FirstValues:    seen.distinct[0],
+		KeptValues:     keptValues,
+		Values:         values,
+		Policy:         policy,
+	})
+
+	resolved := kept
+	switch policy {
+	case duplicatesLast:
+		resolved = rec
+	case duplicatesAverage:
+		average := seen.average()
+		resolved.TaxaCompraManha = average.TaxaCompraManha
+		resolved.TaxaVendaManha = average.TaxaVendaManha
+		resolved.PUCompraManha = average.PUCompraManha
+		resolved.PUVendaManha = average.PUVendaManha
+		resolved.PUBaseManha = average.PUBaseManha
+	}
+	changed := *newRowValues(resolved) != keptValues
+	if changed {
+		seen.keptLine = line
+	}
+	return resolved, changed, nil
+}
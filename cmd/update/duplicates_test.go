@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDuplicates(t *testing.T) {
+	body := csvHeader +
+		"Tesouro IPCA+;15/05/2035;19/12/2025;7,30;7,42;2370,00;2345,00;2345,00\n" +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,20;7,32;2380,00;2355,00;2355,00\n" +
+		"Tesouro IPCA+;15/05/2035;19/12/2025;7,30;7,42;2370,00;2345,00;2345,00\n" +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,40;7,52;2360,00;2335,00;2335,00\n"
+
+	tests := []struct {
+		policy string
+		want   float64 // Taxa Compra Manha kept for the 22nd
+	}{
+		{policy: "", want: 7.40},
+		{policy: duplicatesFirst, want: 7.20},
+		{policy: duplicatesLast, want: 7.40},
+		{policy: duplicatesAverage, want: 7.30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			var emitted []Record
+			p := csvParser{report: parseReport{quiet: true}, duplicates: tt.policy, onRow: func(rec Record) error {
+				emitted = append(emitted, rec)
+				return nil
+			}}
+			latest, err := p.parse(strings.NewReader(body))
+			require.NoError(t, err)
+
+			asset := latest["Tesouro IPCA+|2035-05-15"]
+			require.Len(t, asset.history, 2)
+			assert.InDelta(t, tt.want, asset.history[1].TaxaCompraManha, 1e-9)
+			assert.InDelta(t, tt.want, asset.record.TaxaCompraManha, 1e-9)
+			assert.Equal(t, "2025-12-22", asset.record.DataBase)
+
+			// The identical row is counted but not reported
+			assert.Equal(t, 4, p.report.RowsParsed)
+			assert.Equal(t, 2, p.report.RowsDuplicate)
+			require.Len(t, p.report.Duplicates, 1)
+			dup := p.report.Duplicates[0]
+			assert.Equal(t, 3, dup.FirstLine)
+			assert.Equal(t, 3, dup.KeptLine)
+			assert.Equal(t, 5, dup.Line)
+			assert.Equal(t, 7.20, dup.FirstValues.TaxaCompraManha)
+			assert.Equal(t, 7.40, dup.Values.TaxaCompraManha)
+
+			// A resolved row that changes is emitted again
+			last := emitted[len(emitted)-1]
+			assert.InDelta(t, tt.want, last.TaxaCompraManha, 1e-9)
+			if tt.policy == duplicatesFirst {
+				assert.Len(t, emitted, 2)
+			} else {
+				assert.Len(t, emitted, 3)
+			}
+		})
+	}
+
+	t.Run("average ignores identical rows", func(t *testing.T) {
+		body := csvHeader +
+			"Tesouro IPCA+;15/05/2035;22/12/2025;7,00;7,12;2380,00;2355,00;2355,00\n" +
+			"Tesouro IPCA+;15/05/2035;22/12/2025;7,00;7,12;2380,00;2355,00;2355,00\n" +
+			"Tesouro IPCA+;15/05/2035;22/12/2025;8,00;8,12;2370,00;2345,00;2345,00\n"
+		p := csvParser{report: parseReport{quiet: true}, duplicates: duplicatesAverage}
+		latest, err := p.parse(strings.NewReader(body))
+		require.NoError(t, err)
+
+		rec := latest["Tesouro IPCA+|2035-05-15"].record
+		assert.InDelta(t, 7.50, rec.TaxaCompraManha, 1e-9)
+		assert.InDelta(t, 2375.00, rec.PUCompraManha, 1e-9)
+		assert.Equal(t, 2, p.report.RowsDuplicate)
+		require.Len(t, p.report.Duplicates, 1)
+		assert.Equal(t, 4, p.report.Duplicates[0].Line)
+	})
+
+	t.Run("last reports a row switching back", func(t *testing.T) {
+		body := csvHeader +
+			"Tesouro IPCA+;15/05/2035;22/12/2025;7,00;7,12;2380,00;2355,00;2355,00\n" +
+			"Tesouro IPCA+;15/05/2035;22/12/2025;8,00;8,12;2370,00;2345,00;2345,00\n" +
+			"Tesouro IPCA+;15/05/2035;22/12/2025;7,00;7,12;2380,00;2355,00;2355,00\n"
+		p := csvParser{report: parseReport{quiet: true}, duplicates: duplicatesLast}
+		latest, err := p.parse(strings.NewReader(body))
+		require.NoError(t, err)
+
+		assert.Equal(t, 7.00, latest["Tesouro IPCA+|2035-05-15"].record.TaxaCompraManha)
+		require.Len(t, p.report.Duplicates, 2)
+		dup := p.report.Duplicates[1]
+		assert.Equal(t, 2, dup.FirstLine)
+		assert.Equal(t, 3, dup.KeptLine)
+		assert.Equal(t, 4, dup.Line)
+		assert.Equal(t, 8.00, dup.KeptValues.TaxaCompraManha)
+		assert.Equal(t, 7.00, dup.Values.TaxaCompraManha)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		p := csvParser{report: parseReport{quiet: true}, duplicates: duplicatesError}
+		_, err := p.parse(strings.NewReader(body))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "line 5")
+		assert.Contains(t, err.Error(), "line 3")
+
+		// Identical duplicates are accepted
+		p = csvParser{report: parseReport{quiet: true}, duplicates: duplicatesError}
+		_, err = p.parse(strings.NewReader(strings.Join(strings.SplitAfter(body, "\n")[:4], "")))
+		require.NoError(t, err)
+		assert.Equal(t, 1, p.report.RowsDuplicate)
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import "strings"
+
+// family groups bonds that share an indexer, such as "Tesouro IPCA+" and
+// "Tesouro IPCA+ com Juros Semestrais".
+type family struct {
+	slug string // File-name friendly identifier
+	name string // Display name
+}
+
+// families lists every bond family in display order. The last entry catches
+// any Tipo Titulo not matched by the others.
+var families = []family{
+	{"selic", "Selic"},
+	{"prefixado", "Prefixado"},
+	{"ipca", "IPCA+"},
+	{"igpm", "IGP-M+"},
+	{"renda", "Renda+"},
+	{"educa", "Educa+"},
+	{"outros", "Outros"},
+}
+
+// familyPrefixes maps a Tipo Titulo prefix to its family slug.
+var familyPrefixes = []struct {
+	prefix string
+	slug   string
+}{
+	{"Tesouro Selic", "selic"},
+	{"Tesouro Prefixado", "prefixado"},
+	{"Tesouro IPCA+", "ipca"},
+	{"Tesouro IGPM+", "igpm"},
+	{"Tesouro Renda+", "renda"},
+	{"Tesouro Educa+", "educa"},
+}
+
+func bondFamily(tipoTitulo string) family {
+	slug := "outros"
+	for _, p := range familyPrefixes {
+		if strings.HasPrefix(tipoTitulo, p.prefix) {
+			slug = p.slug
+			break
+		}
+	}
+	for _, f := range families {
+		if f.slug == slug {
+			return f
+		}
+	}
+	return families[len(families)-1]
+}
@@ -0,0 +1,26 @@
+package main
+
+import "fmt"
+
+const (
+	defaultMinRows     = 1000 // The upstream file has tens of thousands of rows
+	defaultMaxBondDrop = 25.0 // Percent
+)
+
+// checkGuardrails refuses to publish data that looks like a truncated or
+// broken upstream file: fewer than minRows parsed rows, or a bond count that
+// dropped by more than maxBondDrop percent since the published snapshot.
+// Either check is disabled by a zero limit, and the second one when nothing
+// was published yet (prevBonds < 0).
+func checkGuardrails(rows, bonds, prevBonds, minRows int, maxBondDrop float64) error {
+	if minRows > 0 && rows < minRows {
+		return fmt.Errorf("refusing to publish: only %d rows parsed (--min-rows %d)", rows, minRows)
+	}
+	if maxBondDrop > 0 && prevBonds > 0 && bonds < prevBonds {
+		drop := float64(prevBonds-bonds) / float64(prevBonds) * 100
+		if drop > maxBondDrop {
+			return fmt.Errorf("refusing to publish: bond count dropped %.1f%% from %d to %d (--max-bond-drop %g)", drop, prevBonds, bonds, maxBondDrop)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckGuardrails(t *testing.T) {
+	tests := []struct {
+		name              string
+		rows, bonds, prev int
+		minRows           int
+		maxBondDrop       float64
+		wantErr           string
+	}{
+		{name: "ok", rows: 5000, bonds: 40, prev: 42, minRows: 1000, maxBondDrop: 25},
+		{name: "too few rows", rows: 999, bonds: 40, prev: 40, minRows: 1000, maxBondDrop: 25, wantErr: "only 999 rows parsed"},
+		{name: "bonds dropped", rows: 5000, bonds: 20, prev: 40, minRows: 1000, maxBondDrop: 25, wantErr: "dropped 50.0% from 40 to 20"},
+		{name: "drop at the limit", rows: 5000, bonds: 30, prev: 40, minRows: 1000, maxBondDrop: 25},
+		{name: "nothing published yet", rows: 5000, bonds: 1, prev: -1, minRows: 1000, maxBondDrop: 25},
+		{name: "disabled", rows: 1, bonds: 1, prev: 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkGuardrails(tt.rows, tt.bonds, tt.prev, tt.minRows, tt.maxBondDrop)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunRefusesBondDrop(t *testing.T) {
+	full := csvHeader +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n" +
+		"Tesouro Selic;01/03/2029;22/12/2025;0,10;0,12;17000,00;16990,00;16990,00\n" +
+		"Tesouro Prefixado;01/01/2029;22/12/2025;12,00;12,10;700,00;690,00;690,00\n"
+	truncated := strings.Join(strings.SplitAfter(full, "\n")[:2], "")
+	dir := t.TempDir()
+
+	require.NoError(t, run(config{url: newCSVServer(t, full).URL, outDir: dir, maxWarnings: -1, maxBondDrop: defaultMaxBondDrop}))
+	published, err := os.ReadFile(filepath.Join(dir, "v2", "latest.json"))
+	require.NoError(t, err)
+
+	err = run(config{url: newCSVServer(t, truncated).URL, outDir: dir, maxWarnings: -1, maxBondDrop: defaultMaxBondDrop})
+	assert.ErrorContains(t, err, "bond count dropped 66.7% from 3 to 1")
+
+	// The published snapshot is left alone
+	data, err := os.ReadFile(filepath.Join(dir, "v2", "latest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, string(published), string(data))
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	healthOK       = "ok"
+	healthStale    = "stale"
+	healthDegraded = "degraded"
+
+	defaultStaleAfter = 2  // Business days the latest Data Base may lag behind today
+	healthGapWindow   = 20 // Gaps within this many business days of the latest Data Base degrade the feed
+)
+
+// errStale is returned with --fail-on-stale when the feed is stale.
+var errStale = errors.New("feed is stale")
+
+// healthReport is published as health.json after every run, for monitoring.
+type healthReport struct {
+	Status             string    `json:"status"`                               // ok, stale or degraded
+	Today              string    `json:"today" schema:"date"`                  // Reference date, Brasília time
+	MaxDataBase        string    `json:"max_data_base" schema:"date-or-empty"` // Latest Data Base across records
+	BusinessDaysBehind int       `json:"business_days_behind"`                 // Business days after max_data_base, up to today
+	StaleAfter         int       `json:"stale_after"`                          // Stale when business_days_behind exceeds this
+	Gaps               []dataGap `json:"gaps"`
+}
+
+// dataGap is a run of business days missing from a bond's history.
+type dataGap struct {
+	Nome           string `json:"nome"`
+	DataVencimento string `json:"data_vencimento" schema:"date"`
+	From           string `json:"from" schema:"date"` // First missing business day
+	To             string `json:"to" schema:"date"`   // Last missing business day
+	Days           int    `json:"days"`
+	Recent         bool   `json:"recent"` // Within the window that degrades the feed
+}
+
+// checkHealth finds the business days missing from each bond's history and
+// rates the feed as of today. A bond that stopped being quoted shortly before
+// the latest Data Base, without having matured, has a gap up to that date.
+func checkHealth(latest map[string]*assetRecord, today time.Time, staleAfter int) healthReport {
+	h := healthReport{Gaps: []dataGap{}}
+
+	var maxDataBase time.Time
+	for _, asset := range latest {
+		if asset.dataBaseMax.After(maxDataBase) {
+			maxDataBase = asset.dataBaseMax
+		}
+	}
+
+	for _, asset := range latest {
+		rec := asset.record
+		var prev time.Time
+		for i, row := range sortedHistory(asset.history) {
+			dataBase, err := time.Parse("2006-01-02", row.DataBase)
+			if err != nil {
+				continue
+			}
+			if i > 0 {
+				if gap, ok := newDataGap(rec, prev, dataBase); ok {
+					h.Gaps = append(h.Gaps, gap)
+				}
+			}
+			prev = dataBase
+		}
+
+		maturity, err := time.Parse("2006-01-02", rec.DataVencimento)
+		if err == nil && maturity.After(maxDataBase) && asset.dataBaseMax.Before(maxDataBase) &&
+			businessDaysBetween(asset.dataBaseMax, maxDataBase) <= healthGapWindow {
+			if gap, ok := newDataGap(rec, asset.dataBaseMax, nextBusinessDay(maxDataBase)); ok {
+				h.Gaps = append(h.Gaps, gap)
+			}
+		}
+	}
+
+	// Twice the window in calendar days always holds more business days,
+	// which saves counting them for old gaps
+	for i := range h.Gaps {
+		to, _ := time.Parse("2006-01-02", h.Gaps[i].To)
+		h.Gaps[i].Recent = to.After(maxDataBase.AddDate(0, 0, -2*healthGapWindow)) &&
+			businessDaysBetween(to, maxDataBase) < healthGapWindow
+	}
+	sort.Slice(h.Gaps, func(i, j int) bool {
+		a, b := h.Gaps[i], h.Gaps[j]
+		if a.Nome != b.Nome {
+			return a.Nome < b.Nome
+		}
+		if a.DataVencimento != b.DataVencimento {
+			return a.DataVencimento < b.DataVencimento
+		}
+		return a.From < b.From
+	})
+
+	if !maxDataBase.IsZero() {
+		h.MaxDataBase = maxDataBase.Format("2006-01-02")
+	}
+	h.refresh(today, staleAfter)
+	return h
+}
+
+// newDataGap returns the business days after last and before next, if any.
+func newDataGap(rec Record, last, next time.Time) (dataGap, bool) {
+	from := nextBusinessDay(last)
+	if !from.Before(next) {
+		return dataGap{}, false
+	}
+	to, days := from, 1
+	for d := nextBusinessDay(from); d.Before(next); d = nextBusinessDay(d) {
+		to = d
+		days++
+	}
+	return dataGap{
+		Nome:           rec.Nome,
+		DataVencimento: rec.DataVencimento,
+		From:           from.Format("2006-01-02"),
+		To:             to.Format("2006-01-02"),
+		Days:           days,
+	}, true
+}
+
+// refresh rates the feed as of today, keeping the gaps already found.
+func (h *healthReport) refresh(today time.Time, staleAfter int) {
+	day := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	h.Today = day.Format("2006-01-02")
+	h.StaleAfter = staleAfter
+	h.BusinessDaysBehind = 0
+
+	maxDataBase, err := time.Parse("2006-01-02", h.MaxDataBase)
+	if err == nil {
+		h.BusinessDaysBehind = businessDaysBetween(maxDataBase, day)
+	}
+	switch {
+	case err != nil || h.BusinessDaysBehind > staleAfter:
+		h.Status = healthStale
+	case h.recentGaps() > 0:
+		h.Status = healthDegraded
+	default:
+		h.Status = healthOK
+	}
+}
+
+func (h healthReport) recentGaps() int {
+	n := 0
+	for _, gap := range h.Gaps {
+		if gap.Recent {
+			n++
+		}
+	}
+	return n
+}
+
+// summary describes a stale or degraded feed in one line.
+func (h healthReport) summary() string {
+	switch h.Status {
+	case healthStale:
+		return fmt.Sprintf("latest Data Base %s is %d business days old (more than %d)", h.MaxDataBase, h.BusinessDaysBehind, h.StaleAfter)
+	case healthDegraded:
+		return fmt.Sprintf("%d recent gaps in bond histories", h.recentGaps())
+	}
+	return "ok"
+}
+
+// setHealth records h in the run report and warns when the feed is not ok.
+func (r *runReport) setHealth(h healthReport) {
+	r.health = &h
+	r.Health = h.Status
+	if h.Status != healthOK {
+		fmt.Fprintf(os.Stderr, "Warning: feed is %s: %s\n", h.Status, h.summary())
+	}
+}
+
+// readPublishedHealth reads the health.json of the last run, if any.
+func readPublishedHealth(outDir string) (healthReport, bool) {
+	var h healthReport
+	data, err := os.ReadFile(filepath.Join(outDir, "health.json"))
+	if err != nil {
+		return h, false
+	}
+	if err := json.Unmarshal(data, &h); err != nil || h.Gaps == nil {
+		return h, false
+	}
+	return h, true
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckHealth(t *testing.T) {
+	body := csvHeader +
+		// Missing the 17th
+		"Tesouro IPCA+;15/05/2035;15/12/2025;7,30;7,42;2370,00;2345,00;2345,00\n" +
+		"Tesouro IPCA+;15/05/2035;16/12/2025;7,30;7,42;2370,00;2345,00;2345,00\n" +
+		"Tesouro IPCA+;15/05/2035;18/12/2025;7,30;7,42;2370,00;2345,00;2345,00\n" +
+		"Tesouro IPCA+;15/05/2035;19/12/2025;7,30;7,42;2370,00;2345,00;2345,00\n" +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,30;7,42;2370,00;2345,00;2345,00\n" +
+		// Missing the latest Data Base
+		"Tesouro Selic;01/03/2029;18/12/2025;0,10;0,12;17000,00;16990,00;16990,00\n" +
+		"Tesouro Selic;01/03/2029;19/12/2025;0,10;0,12;17000,00;16990,00;16990,00\n" +
+		// Matured, so not missing anything
+		"Tesouro Selic;18/12/2025;17/12/2025;0,10;0,12;17000,00;16990,00;16990,00\n" +
+		"Tesouro Selic;18/12/2025;18/12/2025;0,10;0,12;17000,00;16990,00;16990,00\n" +
+		// An old gap, and no longer quoted
+		"Tesouro Prefixado;01/01/2029;01/09/2025;12,00;12,10;700,00;690,00;690,00\n" +
+		"Tesouro Prefixado;01/01/2029;03/09/2025;12,00;12,10;700,00;690,00;690,00\n"
+	latest, err := parseCSV(strings.NewReader(body))
+	require.NoError(t, err)
+	today := time.Date(2025, 12, 23, 9, 0, 0, 0, brt)
+
+	h := checkHealth(latest, today, defaultStaleAfter)
+	assert.Equal(t, "2025-12-22", h.MaxDataBase)
+	assert.Equal(t, "2025-12-23", h.Today)
+	assert.Equal(t, 1, h.BusinessDaysBehind)
+	assert.Equal(t, []dataGap{
+		{Nome: "Tesouro IPCA+ 2035", DataVencimento: "2035-05-15", From: "2025-12-17", To: "2025-12-17", Days: 1, Recent: true},
+		{Nome: "Tesouro Prefixado 2029", DataVencimento: "2029-01-01", From: "2025-09-02", To: "2025-09-02", Days: 1},
+		{Nome: "Tesouro Selic 2029", DataVencimento: "2029-03-01", From: "2025-12-22", To: "2025-12-22", Days: 1, Recent: true},
+	}, h.Gaps)
+	assert.Equal(t, healthDegraded, h.Status)
+
+	h = checkHealth(latest, today, 0)
+	assert.Equal(t, healthStale, h.Status)
+
+	// Weekends and holidays are not gaps, and a day later the feed is stale
+	h = checkHealth(latest, time.Date(2025, 12, 26, 9, 0, 0, 0, brt), defaultStaleAfter)
+	assert.Equal(t, 3, h.BusinessDaysBehind)
+	assert.Equal(t, healthStale, h.Status)
+
+	h = checkHealth(map[string]*assetRecord{}, today, defaultStaleAfter)
+	assert.Equal(t, healthStale, h.Status)
+	assert.Empty(t, h.Gaps)
+}
+
+func TestRunReportsHealth(t *testing.T) {
+	body := csvHeader +
+		"Tesouro IPCA+;15/05/2035;19/12/2025;7,30;7,42;2370,00;2345,00;2345,00\n" +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n"
+	srv := newCSVServer(t, body)
+	dir := t.TempDir()
+	cfg := config{url: srv.URL, outDir: dir, maxWarnings: -1, staleAfter: defaultStaleAfter,
+		asOf: time.Date(2025, 12, 23, 12, 0, 0, 0, time.UTC)}
+
+	readHealth := func() healthReport {
+		h, ok := readPublishedHealth(dir)
+		require.True(t, ok)
+		return h
+	}
+
+	require.NoError(t, run(cfg))
+	assert.Equal(t, healthOK, readHealth().Status)
+
+	// Stale data is still published, but fails the run when asked to
+	cfg.asOf = time.Date(2025, 12, 30, 12, 0, 0, 0, time.UTC)
+	cfg.failOnStale = true
+	cfg.force = true
+	err := run(cfg)
+	require.ErrorIs(t, err, errStale)
+	h := readHealth()
+	assert.Equal(t, healthStale, h.Status)
+	assert.Equal(t, 5, h.BusinessDaysBehind)
+	assert.FileExists(t, filepath.Join(dir, "v2", "latest.json"))
+
+	data, err := os.ReadFile(filepath.Join(dir, "run.json"))
+	require.NoError(t, err)
+	var report runReport
+	require.NoError(t, json.Unmarshal(data, &report))
+	assert.Equal(t, statusFailed, report.Status)
+	assert.Equal(t, healthStale, report.Health)
+	assert.Contains(t, report.Error, "5 business days old")
+
+	cfg.failOnStale = false
+	require.NoError(t, run(cfg))
+}
+
+func TestRunRefreshesHealthWhenSkipping(t *testing.T) {
+	body := csvHeader + "Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n"
+	_, srv := newConditionalServer(t, body)
+	root := t.TempDir()
+	cfg := config{url: srv.URL, outDir: filepath.Join(root, "public"), cacheDir: filepath.Join(root, "cache"), maxWarnings: -1,
+		staleAfter: defaultStaleAfter, asOf: time.Date(2025, 12, 23, 12, 0, 0, 0, time.UTC)}
+	require.NoError(t, run(cfg))
+
+	// The skipped run reuses the published data, rated as of its own date
+	cfg.asOf = time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	cfg.failOnStale = true
+	require.ErrorIs(t, run(cfg), errStale)
+	h, ok := readPublishedHealth(cfg.outDir)
+	require.True(t, ok)
+	assert.Equal(t, "2026-01-05", h.Today)
+	assert.Equal(t, healthStale, h.Status)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Magic bytes of the compressed formats accepted by --input
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// readCloser closes closer after reading from Reader.
+type readCloser struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (rc readCloser) Close() error { return rc.closer.Close() }
+
+// openInput opens a local CSV given with --input: a path, or "-" for stdin.
+// Gzip and zip files are recognized by their magic bytes, whatever their name.
+func openInput(path string) (source, error) {
+	if path == "-" {
+		body, err := decompress(io.NopCloser(os.Stdin))
+		return source{body: body}, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return source{}, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return source{}, err
+	}
+	body, err := decompress(file)
+	if err != nil {
+		file.Close()
+		return source{}, err
+	}
+	return source{
+		body:         body,
+		lastModified: info.ModTime().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// decompress returns the CSV held by rc, which is read as is unless it starts
+// with the gzip or zip magic bytes.
+func decompress(rc io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(rc)
+	magic, _ := br.Peek(len(zipMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip input: %w", err)
+		}
+		return readCloser{zr, rc}, nil
+
+	case bytes.HasPrefix(magic, zipMagic):
+		// Zip needs random access, and stdin has none
+		data, err := io.ReadAll(br)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid zip input: %w", err)
+		}
+		entry, err := zipCSVEntry(zr.File)
+		if err != nil {
+			return nil, err
+		}
+		return entry.Open()
+	}
+
+	return readCloser{br, rc}, nil
+}
+
+// zipCSVEntry picks the CSV inside a zip archive: its only file, or else its
+// only .csv file.
+func zipCSVEntry(files []*zip.File) (*zip.File, error) {
+	var regular, csvs []*zip.File
+	for _, f := range files {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		regular = append(regular, f)
+		if strings.EqualFold(filepath.Ext(f.Name), ".csv") {
+			csvs = append(csvs, f)
+		}
+	}
+
+	switch {
+	case len(regular) == 1:
+		return regular[0], nil
+	case len(csvs) == 1:
+		return csvs[0], nil
+	case len(csvs) == 0:
+		return nil, fmt.Errorf("zip input has no .csv file")
+	}
+	return nil, fmt.Errorf("zip input has %d .csv files, expected one", len(csvs))
+}
+
+// sourceURL identifies where the data came from, for run.json and the
+// published metadata: the download URL, a file URL for --input, or "stdin".
+// A replay keeps the URL the archived file was downloaded from.
+func (cfg config) sourceURL() string {
+	if cfg.replayOf != nil {
+		return cfg.replayOf.SourceURL
+	}
+	switch cfg.input {
+	case "":
+		return cfg.url
+	case "-":
+		return "stdin"
+	}
+	path, err := filepath.Abs(cfg.input)
+	if err != nil {
+		path = cfg.input
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
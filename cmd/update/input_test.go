@@ -0,0 +1,106 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenInput(t *testing.T) {
+	csv := csvHeader + "Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n"
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(csv))
+	require.NoError(t, zw.Close())
+
+	zipWith := func(files map[string]string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, content := range files {
+			w, err := zw.Create(name)
+			require.NoError(t, err)
+			w.Write([]byte(content))
+		}
+		require.NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+		wantErr string
+	}{
+		{"plain", "data.csv", []byte(csv), ""},
+		{"gzip", "data.csv.gz", gz.Bytes(), ""},
+		{"gzip without extension", "download", gz.Bytes(), ""},
+		{"zip", "data.zip", zipWith(map[string]string{"PrecoTaxaTesouroDireto.csv": csv}), ""},
+		{"zip with other files", "data.zip", zipWith(map[string]string{"README.txt": "notes", "precos.CSV": csv}), ""},
+		{"zip without csv", "data.zip", zipWith(map[string]string{"a.txt": "", "b.txt": ""}), "no .csv file"},
+		{"zip with two csvs", "data.zip", zipWith(map[string]string{"a.csv": csv, "b.csv": csv}), "2 .csv files"},
+		{"truncated gzip", "data.gz", gz.Bytes()[:5], "invalid gzip input"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			require.NoError(t, os.WriteFile(path, tt.content, 0644))
+
+			src, err := openInput(path)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			defer src.body.Close()
+			data, err := io.ReadAll(src.body)
+			require.NoError(t, err)
+			assert.Equal(t, csv, string(data))
+			assert.NotEmpty(t, src.lastModified)
+		})
+	}
+
+	t.Run("stdin", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "stdin")
+		require.NoError(t, os.WriteFile(path, gz.Bytes(), 0644))
+		stdin, err := os.Open(path)
+		require.NoError(t, err)
+		defer stdin.Close()
+		orig := os.Stdin
+		os.Stdin = stdin
+		defer func() { os.Stdin = orig }()
+
+		src, err := openInput("-")
+		require.NoError(t, err)
+		data, err := io.ReadAll(src.body)
+		require.NoError(t, err)
+		assert.Equal(t, csv, string(data))
+	})
+}
+
+func TestRunFromInput(t *testing.T) {
+	csv := csvHeader + "Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n"
+	root := t.TempDir()
+	input := filepath.Join(root, "archive.csv.gz")
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(csv))
+	require.NoError(t, zw.Close())
+	require.NoError(t, os.WriteFile(input, gz.Bytes(), 0644))
+
+	cfg := config{url: "http://127.0.0.1:1/unreachable", input: input, outDir: filepath.Join(root, "public"), maxWarnings: -1}
+	require.NoError(t, run(cfg))
+
+	envelope, ok := readPublishedEnvelope(cfg.outDir)
+	require.True(t, ok)
+	assert.Equal(t, "file://"+filepath.ToSlash(input), envelope.SourceURL)
+	require.Len(t, envelope.Records, 1)
+	assert.Equal(t, "Tesouro IPCA+ 2035", envelope.Records[0].Nome)
+}
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -137,3 +142,189 @@ Tesouro Prefixado;01/01/2008;31/12/2024;10,20;10,30;905,00;904,00;904,00`
 	expectedMin, _ := time.Parse("2006-01-02", "2020-01-01")
 	assert.Equal(t, expectedMin, asset2008.dataBaseMin)
 }
+
+func TestRunWritesReport(t *testing.T) {
+	body := csvHeader +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n" +
+		"Tesouro IPCA+;15/05/2035\n" +
+		"Tesouro Selic;17/03/2010;22/12/2025;0,00;0,03;3185,95;3183,49;3182,12\n"
+	srv := newCSVServer(t, body)
+
+	readReport := func(t *testing.T, dir string) runReport {
+		data, err := os.ReadFile(filepath.Join(dir, "run.json"))
+		require.NoError(t, err)
+		var report runReport
+		require.NoError(t, json.Unmarshal(data, &report))
+		return report
+	}
+
+	t.Run("success", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, run(config{url: srv.URL, outDir: dir, maxWarnings: -1}))
+
+		report := readReport(t, dir)
+		assert.Equal(t, statusOK, report.Status)
+		assert.Equal(t, srv.URL, report.SourceURL)
+		assert.Equal(t, 3, report.RowsRead)
+		assert.Equal(t, 2, report.RowsParsed)
+		assert.Equal(t, 1, report.RowsShort)
+		assert.Equal(t, 2, report.Records)
+		require.Len(t, report.Warnings, 1)
+		assert.Equal(t, diagShortRow, report.Warnings[0].Kind)
+		assert.FileExists(t, filepath.Join(dir, "latest.json"))
+	})
+
+	t.Run("too many warnings", func(t *testing.T) {
+		dir := t.TempDir()
+		err := run(config{url: srv.URL, outDir: dir, maxWarnings: 0})
+		require.Error(t, err)
+
+		report := readReport(t, dir)
+		assert.Equal(t, statusFailed, report.Status)
+		assert.Contains(t, report.Error, "too many parse warnings")
+		assert.NoFileExists(t, filepath.Join(dir, "latest.json"))
+	})
+}
+
+func TestRunWritesVersionedLatest(t *testing.T) {
+	body := csvHeader +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n" +
+		"Tesouro Selic;17/03/2010;19/12/2025;0,00;0,03;3185,95;3183,49;3182,12\n"
+	srv := newCSVServer(t, body)
+	dir := t.TempDir()
+	require.NoError(t, run(config{url: srv.URL, outDir: dir, maxWarnings: -1}))
+
+	data, err := os.ReadFile(filepath.Join(dir, "v2", "latest.json"))
+	require.NoError(t, err)
+	var envelope latestEnvelope
+	require.NoError(t, json.Unmarshal(data, &envelope))
+
+	sum := sha256.Sum256([]byte(body))
+	assert.Equal(t, schemaVersion, envelope.SchemaVersion)
+	assert.Equal(t, srv.URL, envelope.SourceURL)
+	assert.Equal(t, hex.EncodeToString(sum[:]), envelope.SourceSHA256)
+	assert.Equal(t, "2025-12-22", envelope.MaxDataBase)
+	_, err = time.Parse(time.RFC3339, envelope.GeneratedAt)
+	assert.NoError(t, err)
+
+	// Legacy bare array is still published with the same records
+	data, err = os.ReadFile(filepath.Join(dir, "latest.json"))
+	require.NoError(t, err)
+	var legacy []Record
+	require.NoError(t, json.Unmarshal(data, &legacy))
+	assert.Equal(t, legacy, envelope.Records)
+}
+
+func TestRunPublishesAtomically(t *testing.T) {
+	good := csvHeader +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n"
+	bad := csvHeader +
+		"Tesouro IPCA+;15/05/2035;23/12/2025;7,29;7,41;0,00;2348,76;2348,76\n"
+	dir := filepath.Join(t.TempDir(), "public")
+
+	require.NoError(t, run(config{url: newCSVServer(t, good).URL, outDir: dir, maxWarnings: -1, keep: 1}))
+	before, err := os.ReadFile(filepath.Join(dir, "latest.json"))
+	require.NoError(t, err)
+	beforeAnomalies, err := os.ReadFile(filepath.Join(dir, "anomalies.json"))
+	require.NoError(t, err)
+
+	// A refused run leaves the published outputs untouched, and explains
+	// itself in a file outside SHA256SUMS
+	err = run(config{url: newCSVServer(t, bad).URL, outDir: dir, maxWarnings: -1, strict: true, keep: 1, compress: true})
+	require.Error(t, err)
+	after, err := os.ReadFile(filepath.Join(dir, "latest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+	afterAnomalies, err := os.ReadFile(filepath.Join(dir, "anomalies.json"))
+	require.NoError(t, err)
+	assert.Equal(t, beforeAnomalies, afterAnomalies)
+	assert.FileExists(t, filepath.Join(dir, rejectedFile))
+	assert.NoFileExists(t, filepath.Join(dir, rejectedFile+".gz"), "under compressMinSize")
+	assert.NoDirExists(t, stagingDir(dir))
+	assert.NoDirExists(t, generationDir(dir, 1))
+
+	// A successful run keeps the previous generation for rollback, and no
+	// file of the old one survives in the new outputs
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "xml", "old.xml"), nil, 0644))
+	require.NoError(t, run(config{url: newCSVServer(t, good).URL, outDir: dir, maxWarnings: -1, keep: 1, force: true}))
+	assert.FileExists(t, filepath.Join(generationDir(dir, 1), "latest.json"))
+	assert.NoFileExists(t, filepath.Join(dir, "xml", "old.xml"))
+	assert.FileExists(t, filepath.Join(dir, "run.json"))
+	assert.NoFileExists(t, filepath.Join(dir, rejectedFile))
+}
+
+func TestRunSkipsUnchangedContent(t *testing.T) {
+	body := csvHeader +
+		"Tesouro IPCA+;15/05/2035;19/12/2025;7,30;7,42;2370,00;2345,00;2345,00\n" +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n"
+	srv := newCSVServer(t, body)
+	dir := filepath.Join(t.TempDir(), "public")
+	cfg := config{url: srv.URL, outDir: dir, maxWarnings: -1, compress: true}
+	require.NoError(t, run(cfg))
+	first := readTree(t, dir)
+
+	// Same rows in a different order hash the same and publish nothing
+	reordered := csvHeader +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n" +
+		"Tesouro IPCA+;15/05/2035;19/12/2025;7,30;7,42;2370,00;2345,00;2345,00\n"
+	cfg.url = newCSVServer(t, reordered).URL
+	err := run(cfg)
+	require.ErrorIs(t, err, errUnchanged)
+	assert.NoDirExists(t, generationDir(dir, 1))
+
+	data, err := os.ReadFile(filepath.Join(dir, "run.json"))
+	require.NoError(t, err)
+	var report runReport
+	require.NoError(t, json.Unmarshal(data, &report))
+	assert.Equal(t, statusUnchanged, report.Status)
+	assert.Empty(t, report.Error)
+
+	// A forced republish of the same data gives byte-identical files
+	cfg.url = srv.URL
+	cfg.force = true
+	require.NoError(t, run(cfg))
+	second := readTree(t, dir)
+	require.Equal(t, len(first), len(second))
+	for path, content := range first {
+		if strings.HasPrefix(path, "run.json") {
+			continue
+		}
+		assert.Equal(t, content, second[path], path)
+	}
+
+	// The same rows with different output options are republished
+	cfg.force = false
+	cfg.csvDecimals = map[string]int{"taxa_compra_manha": 3}
+	require.NoError(t, run(cfg))
+	csv, err := os.ReadFile(filepath.Join(dir, "latest.csv"))
+	require.NoError(t, err)
+	assert.Contains(t, string(csv), "7,290")
+}
+
+// readTree returns the content of every file under dir, keyed by relative path.
+func readTree(t *testing.T, dir string) map[string][]byte {
+	files := map[string][]byte{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files[rel] = data
+		return nil
+	})
+	require.NoError(t, err)
+	return files
+}
+
+// newCSVServer serves body as the upstream CSV for the duration of the test.
+func newCSVServer(t *testing.T, body string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
@@ -1,41 +1,426 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 )
 
+const (
+	exitUnchanged = 3 // The data matches the published outputs
+	exitStale     = 4 // The feed is stale and --fail-on-stale was given
+)
+
+// commands are the subcommands, selected by the first argument
+var commands = map[string]func(args []string, out io.Writer) error{
+	"verify": verifyCommand,
+	"keygen": keygenCommand,
+	"replay": replayCommand,
+}
+
+// brt is the Brasília time zone, used for the feed's calendar dates
+var brt = time.FixedZone("BRT", -3*60*60)
+
+type config struct {
+	url         string
+	input       string // Local CSV path, or "-" for stdin, read instead of url
+	outDir      string
+	strict      bool               // Refuse to publish when a severe anomaly is found
+	maxStdDev   float64            // Rate jump threshold in standard deviations
+	maxWarnings int                // Fail when the parser reports more warnings than this (-1 disables)
+	duplicates  string             // Policy for rows sharing a bond and Data Base: first, last, average or error
+	minRows     int                // Refuse to publish fewer parsed rows than this (0 disables)
+	maxBondDrop float64            // Refuse to publish when the bond count drops by more than this percentage (0 disables)
+	csvOutputs  []csvOutput        // Extra CSV dialects, published next to the defaults
+	csvDecimals map[string]int     // Fixed decimals per numeric column, for every CSV output
+	format      string             // "all" publishes every output, "ndjson" only NDJSON
+	stdout      bool               // Stream NDJSON to stdout instead of writing files
+	history     bool               // Emit every parsed row instead of the latest per bond (NDJSON only)
+	compress    bool               // Write .gz and .br variants of every published file
+	keep        int                // Previous output directories kept for rollback
+	force       bool               // Publish even when the content is unchanged
+	signingKey  ed25519.PrivateKey // Signs SHA256SUMS (nil leaves it unsigned)
+	cacheDir    string             // Raw cache of the upstream CSV (empty disables)
+	archiveDir  string             // Archive of every distinct upstream file (empty disables)
+	replayOf    *archiveEntry      // Archived file being replayed, whose source metadata the outputs keep
+	asOf        time.Time          // Time the run is dated at, instead of now (replay)
+	retries     int                // Download retries after the first attempt
+	retryDelay  time.Duration      // Delay before the first retry, doubled on each one
+	timeout     time.Duration      // Timeout of each download attempt
+	staleAfter  int                // Business days the latest Data Base may lag behind today
+	failOnStale bool               // Exit with exitStale when the feed is stale
+}
+
 func main() {
-	url := flag.String("url", defaultURL, "URL to download CSV from")
-	outDir := flag.String("outdir", defaultOutDir, "Output directory for generated files")
-	flag.Parse()
+	// Subcommands other than the default update
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			err := command(os.Args[2:], os.Stdout)
+			if errors.Is(err, flag.ErrHelp) {
+				os.Exit(0)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	cfg, err := parseConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
 
-	if err := run(*url, *outDir); err != nil {
+	err = run(cfg)
+	if errors.Is(err, errUnchanged) {
+		fmt.Println("Nothing to publish:", err)
+		os.Exit(exitUnchanged)
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, errStale) {
+			os.Exit(exitStale)
+		}
 		os.Exit(1)
 	}
 }
 
-func run(url, outDir string) error {
-	// Create output directory
-	if err := os.MkdirAll(outDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+func parseConfig(args []string) (config, error) {
+	var cfg config
+	fs := flag.NewFlagSet("update", flag.ContinueOnError)
+	fs.StringVar(&cfg.url, "url", defaultURL, "URL to download CSV from")
+	fs.StringVar(&cfg.input, "input", "", "Read the CSV from this file (plain, .gz or .zip) or - for stdin instead of downloading it")
+	fs.StringVar(&cfg.outDir, "outdir", defaultOutDir, "Output directory for generated files")
+	fs.IntVar(&cfg.retries, "retries", defaultRetries, "Download retries for server errors, timeouts and dropped connections")
+	fs.DurationVar(&cfg.retryDelay, "retry-delay", defaultRetryDelay, "Delay before the first download retry, doubled on each one")
+	fs.DurationVar(&cfg.timeout, "timeout", defaultTimeout, "Timeout of each download attempt")
+	fs.StringVar(&cfg.archiveDir, "archive-dir", "", "Directory archiving every distinct upstream file, e.g. "+defaultArchiveDir+" (empty disables)")
+	fs.StringVar(&cfg.cacheDir, "cache-dir", "", "Directory caching the upstream CSV for conditional downloads (empty disables)")
+	fs.BoolVar(&cfg.strict, "strict", false, "Refuse to publish when a severe anomaly is detected")
+	fs.Float64Var(&cfg.maxStdDev, "anomaly-stddev", defaultMaxStdDev, "Flag rate jumps beyond this many standard deviations (0 disables)")
+	fs.IntVar(&cfg.maxWarnings, "max-warnings", -1, "Fail when parsing produces more warnings than this (-1 disables)")
+	fs.IntVar(&cfg.minRows, "min-rows", defaultMinRows, "Refuse to publish when fewer rows are parsed (0 disables)")
+	fs.Float64Var(&cfg.maxBondDrop, "max-bond-drop", defaultMaxBondDrop, "Refuse to publish when the bond count drops by more than this percentage since the last publish (0 disables)")
+	fs.IntVar(&cfg.staleAfter, "stale-after", defaultStaleAfter, "Business days the latest Data Base may lag behind today before the feed is stale")
+	fs.BoolVar(&cfg.failOnStale, "fail-on-stale", false, "Exit with status 4 when the feed is stale")
+	fs.StringVar(&cfg.duplicates, "duplicates", duplicatesLast, "Rows sharing a bond and Data Base: keep the first, last or average, or fail with error")
+	var csvOutputs csvOutputFlag
+	fs.Var(&csvOutputs, "csv", "Extra CSV output, e.g. file=latest.us.csv,delimiter=comma,decimal=.,date=mm/dd/yyyy,lang=en (repeatable)")
+	csvDecimals := fs.String("csv-decimals", "", "Fixed decimals per CSV column, e.g. taxa_compra_manha=2,pu_base_manha=6")
+	fs.StringVar(&cfg.format, "format", formatAll, "Output format: all or ndjson")
+	fs.BoolVar(&cfg.stdout, "stdout", false, "Stream NDJSON records to stdout instead of writing files")
+	fs.BoolVar(&cfg.history, "history", false, "Emit every parsed row instead of the latest per bond (NDJSON only)")
+	fs.BoolVar(&cfg.compress, "compress", true, "Write .gz and .br variants of every published file")
+	fs.BoolVar(&cfg.force, "force", false, "Publish even when the content is unchanged since the last publish")
+	signingKey := fs.String("signing-key", "", "File holding the base64 ed25519 key that signs SHA256SUMS (default $"+signingKeyEnv+")")
+	fs.IntVar(&cfg.keep, "keep-generations", defaultKeepGenerations, "Previous output directories to keep for rollback")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
 	}
 
-	// Download CSV
-	resp, err := downloadCSV(url)
+	cfg.csvOutputs = csvOutputs
+	decimals, err := parseDecimals(*csvDecimals)
 	if err != nil {
+		return cfg, fmt.Errorf("--csv-decimals: %w", err)
+	}
+	cfg.csvDecimals = decimals
+	if cfg.signingKey, err = loadSigningKey(*signingKey); err != nil {
+		return cfg, fmt.Errorf("--signing-key: %w", err)
+	}
+
+	// stdout only makes sense for the line-oriented format
+	if cfg.stdout {
+		if cfg.format != formatAll && cfg.format != formatNDJSON {
+			return cfg, fmt.Errorf("--stdout requires --format ndjson")
+		}
+		cfg.format = formatNDJSON
+	}
+	switch cfg.format {
+	case formatAll, formatNDJSON:
+	default:
+		return cfg, fmt.Errorf("unknown --format %q: expected all or ndjson", cfg.format)
+	}
+	if cfg.history && cfg.format != formatNDJSON {
+		return cfg, fmt.Errorf("--history requires --format ndjson")
+	}
+	if !validDuplicatesPolicy(cfg.duplicates) {
+		return cfg, fmt.Errorf("unknown --duplicates %q: expected first, last, average or error", cfg.duplicates)
+	}
+	if cfg.retries < 0 {
+		return cfg, fmt.Errorf("--retries must not be negative")
+	}
+	if cfg.minRows < 0 {
+		return cfg, fmt.Errorf("--min-rows must not be negative")
+	}
+	if cfg.maxBondDrop < 0 || cfg.maxBondDrop > 100 {
+		return cfg, fmt.Errorf("--max-bond-drop must be between 0 and 100")
+	}
+	if cfg.staleAfter < 0 {
+		return cfg, fmt.Errorf("--stale-after must not be negative")
+	}
+	if cfg.keep < 0 {
+		return cfg, fmt.Errorf("--keep-generations must not be negative")
+	}
+
+	return cfg, nil
+}
+
+func run(cfg config) error {
+	start := time.Now()
+	report := newRunReport(cfg.sourceURL(), start)
+
+	err := process(cfg, report, start)
+	if cfg.failOnStale && report.Health == healthStale && (err == nil || errors.Is(err, errUnchanged)) {
+		err = fmt.Errorf("%w: %s", errStale, report.health.summary())
+	}
+	report.finish(start, err)
+
+	// Nothing is written to the output directory in stdout mode
+	if cfg.stdout {
+		return err
+	}
+
+	// Publish the run report and feed health even when the run failed. They
+	// describe the last run, so they are written to the live directory after
+	// the swap, outside SHA256SUMS. So are the findings behind a refusal,
+	// which leave the published anomalies.json matching the published data.
+	publish := func(v any, name string) error {
+		path := filepath.Join(cfg.outDir, name)
+		if err := writeJSON(v, path); err != nil || !cfg.compress {
+			return err
+		}
+		return compressFile(path)
+	}
+	werr := os.MkdirAll(cfg.outDir, 0755)
+	if werr == nil {
+		werr = publish(report, "run.json")
+	}
+	if werr == nil && report.health != nil {
+		werr = publish(report.health, "health.json")
+	}
+	if werr == nil {
+		if report.rejected != nil {
+			werr = publish(report.rejected, rejectedFile)
+		} else {
+			werr = removeOutput(filepath.Join(cfg.outDir, rejectedFile))
+		}
+	}
+	if werr != nil && err == nil {
+		err = fmt.Errorf("failed to write run report: %w", werr)
+	}
+	return err
+}
+
+func process(cfg config, report *runReport, start time.Time) error {
+	mark := start
+	now := start
+	if !cfg.asOf.IsZero() {
+		now = cfg.asOf
+	}
+
+	// Status messages go to stderr when stdout carries the data
+	status := io.Writer(os.Stdout)
+	if cfg.stdout {
+		status = os.Stderr
+	}
+
+	// Full publishes are staged in a sibling directory and swapped in as a
+	// whole, so a failed run never leaves a mix of old and new files. NDJSON
+	// writes its files in place, so it needs a directory of its own.
+	dir := cfg.outDir
+	switch {
+	case cfg.format != formatNDJSON:
+		staging, err := newStagingDir(cfg.outDir)
+		if err != nil {
+			return fmt.Errorf("failed to create staging directory: %w", err)
+		}
+		defer os.RemoveAll(staging)
+		dir = staging
+	case !cfg.stdout:
+		// The next full publish would replace these files with its own
+		// generation, and SHA256SUMS would not cover them
+		if _, ok := readPublishedEnvelope(cfg.outDir); ok {
+			return fmt.Errorf("%s holds a full publish: write NDJSON to its own --outdir", cfg.outDir)
+		}
+		if err := os.MkdirAll(cfg.outDir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	// Download CSV, or read it from --input
+	var src source
+	var err error
+	if cfg.input != "" {
+		if src, err = openInput(cfg.input); err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		if cfg.replayOf != nil {
+			src.lastModified = cfg.replayOf.LastModified
+			src.etag = cfg.replayOf.ETag
+			src.incremental = cfg.replayOf.Incremental
+		}
+	} else if src, err = openSource(newFetcher(cfg.timeout, cfg.retries, cfg.retryDelay), cfg.url, cfg.cacheDir); err != nil {
 		return fmt.Errorf("failed to download CSV: %w", err)
 	}
-	defer resp.Body.Close()
+	defer src.body.Close()
+	report.CacheHit = src.cacheHit
+	report.Incremental = src.incremental
+	report.Timings.Download = stage(&mark)
 
-	// Parse CSV and extract latest records
-	latest, err := parseCSV(resp.Body)
+	// The published snapshot already comes from these exact bytes, with the
+	// same settings, so there is nothing to parse
+	settings := settingsHash(cfg)
+	if src.sha256 != "" && cfg.format != formatNDJSON && !cfg.force {
+		if prev, ok := readPublishedEnvelope(cfg.outDir); ok && prev.SourceSHA256 == src.sha256 && prev.SettingsSHA256 == settings {
+			report.Records = len(prev.Records)
+			report.ContentSHA256 = prev.ContentSHA256
+
+			// Only staleness can change; gaps come from the last check
+			health, ok := readPublishedHealth(cfg.outDir)
+			if !ok {
+				health = healthReport{Gaps: []dataGap{}}
+			}
+			health.MaxDataBase = prev.MaxDataBase
+			health.refresh(now.In(brt), cfg.staleAfter)
+			report.setHealth(health)
+			fmt.Fprintf(status, "Source unchanged (sha256 %s), skipping publish\n", src.sha256)
+			return errUnchanged
+		}
+	}
+
+	// Parse CSV and extract latest records, hashing the raw bytes as they stream by
+	sourceHash := sha256.New()
+	parser := csvParser{duplicates: cfg.duplicates}
+	var sink *ndjsonSink
+	if cfg.format == formatNDJSON {
+		if cfg.stdout {
+			sink = newStdoutSink(os.Stdout)
+		} else {
+			name := "latest.ndjson"
+			if cfg.history {
+				name = "history.ndjson"
+			}
+			if sink, err = newFileSink(filepath.Join(dir, name)); err != nil {
+				return fmt.Errorf("failed to create NDJSON output: %w", err)
+			}
+		}
+		defer sink.abort()
+
+		// On stdout history rows are streamed while parsing, before the
+		// start date of each bond and duplicate rows are known
+		if cfg.history && cfg.stdout {
+			parser.onRow = sink.write
+		}
+	}
+	body := io.TeeReader(src.body, sourceHash)
+	// A replay reads the archive but never adds to it
+	var archive *archiveWriter
+	if cfg.archiveDir != "" && cfg.replayOf == nil {
+		if archive, err = newArchiveWriter(cfg.archiveDir); err != nil {
+			return fmt.Errorf("failed to create archive file: %w", err)
+		}
+		defer archive.abort()
+		body = io.TeeReader(body, archive)
+	}
+	latest, err := parser.parse(body)
+	report.parseReport = parser.report
+	if report.Warnings == nil {
+		report.Warnings = []parseDiagnostic{}
+	}
+	if report.Duplicates == nil {
+		report.Duplicates = []duplicateRow{}
+	}
+	report.Timings.Parse = stage(&mark)
 	if err != nil {
 		return fmt.Errorf("failed to parse CSV: %w", err)
 	}
+	sourceSHA256 := hex.EncodeToString(sourceHash.Sum(nil))
+
+	// Compare past rows with the archived file behind the published snapshot,
+	// not with files refused since, then archive the raw file, whatever
+	// happens next, so any run can be replayed. A republish of the same file
+	// keeps the published comparison, and a replay the one of its run.
+	published, havePublished := readPublishedEnvelope(cfg.outDir)
+	revisions := detectRevisions(nil, latest)
+	if cfg.archiveDir != "" {
+		base := published.SourceSHA256
+		switch {
+		case cfg.replayOf != nil:
+			base = cfg.replayOf.RevisionsBase
+		case base == sourceSHA256:
+			base = publishedRevisionsBase(cfg.outDir)
+		}
+		if revisions, err = compareWithArchive(latest, cfg.archiveDir, base, cfg.duplicates); err != nil {
+			return fmt.Errorf("failed to compare with the archive: %w", err)
+		}
+		report.Revisions = revisions.count()
+		if report.Revisions > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: upstream revised %d past rows since %s (see revisions.json)\n", report.Revisions, revisions.PreviousFetchedAt)
+		}
+	}
+	if archive != nil {
+		err := archive.commit(archiveEntry{
+			SHA256:        sourceSHA256,
+			FetchedAt:     now.UTC().Format(time.RFC3339),
+			SourceURL:     cfg.sourceURL(),
+			ETag:          src.etag,
+			LastModified:  src.lastModified,
+			Rows:          report.RowsRead,
+			MaxDataBase:   latestDataBase(latest),
+			Incremental:   src.incremental,
+			Options:       cfg.outputOptions(),
+			RevisionsBase: revisions.PreviousSHA256,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to archive CSV: %w", err)
+		}
+	}
+	if cfg.maxWarnings >= 0 && len(report.Warnings) > cfg.maxWarnings {
+		return fmt.Errorf("too many parse warnings: %d (max %d)", len(report.Warnings), cfg.maxWarnings)
+	}
+
+	// A truncated file or an error page parses into far fewer rows and bonds
+	prevBonds := -1
+	if havePublished {
+		prevBonds = len(published.Records)
+	}
+	if err := checkGuardrails(report.RowsParsed, len(latest), prevBonds, cfg.minRows, cfg.maxBondDrop); err != nil {
+		return err
+	}
+
+	// Validate before publishing anything
+	anomalies := detectAnomalies(latest, anomalyRules{
+		maxStdDev: cfg.maxStdDev,
+		today:     now.In(brt),
+	})
+	report.Anomalies = len(anomalies)
+	if !cfg.stdout {
+		if err := writeJSON(anomalies, filepath.Join(dir, "anomalies.json")); err != nil {
+			return fmt.Errorf("failed to write anomalies: %w", err)
+		}
+	}
+	for _, a := range anomalies {
+		fmt.Fprintf(os.Stderr, "Anomaly (%s): %s %s: %s\n", a.Severity, a.Nome, a.DataVencimento, a.Message)
+	}
+	report.setHealth(checkHealth(latest, now.In(brt), cfg.staleAfter))
+	report.Timings.Validate = stage(&mark)
+	if severe := countSevere(anomalies); cfg.strict && severe > 0 {
+		// The findings are published next to run.json; the data is not
+		report.rejected = anomalies
+		return fmt.Errorf("refusing to publish: %d severe anomalies found (see %s)", severe, rejectedFile)
+	}
 
 	// Convert to sorted slice and set DataInicio (start date)
 	records := make([]Record, 0, len(latest))
@@ -44,19 +429,133 @@ func run(url, outDir string) error {
 		records = append(records, asset.record)
 	}
 	sortRecords(records)
+	report.Records = len(records)
+	if report.ContentSHA256, err = contentHash(latest, settings); err != nil {
+		return fmt.Errorf("failed to hash content: %w", err)
+	}
+
+	// NDJSON mode emits records and skips every other output
+	if sink != nil {
+		rows := records
+		if cfg.history {
+			rows = nil
+			if !cfg.stdout {
+				rows = historyRecords(latest, records)
+			}
+		}
+		for _, rec := range rows {
+			if err := sink.write(rec); err != nil {
+				return fmt.Errorf("failed to write NDJSON: %w", err)
+			}
+		}
+		if err := sink.commit(); err != nil {
+			return fmt.Errorf("failed to write NDJSON: %w", err)
+		}
+		if cfg.compress && !cfg.stdout {
+			for _, path := range []string{sink.path, filepath.Join(dir, "anomalies.json")} {
+				if err := compressFile(path); err != nil {
+					return fmt.Errorf("failed to compress outputs: %w", err)
+				}
+			}
+		}
+		report.Timings.Write = stage(&mark)
+		fmt.Fprintf(status, "Successfully processed %d records\n", len(records))
+		return nil
+	}
+
+	// Skip publishing when the data matches the live outputs. Forced
+	// republishes keep the previous timestamp so the files stay identical.
+	envelope := newLatestEnvelope(records, cfg.sourceURL(), sourceSHA256, now)
+	envelope.ContentSHA256 = report.ContentSHA256
+	envelope.SettingsSHA256 = settings
+	envelope.SourceLastModified = src.lastModified
+	if prev, ok := readPublishedEnvelope(cfg.outDir); ok && prev.ContentSHA256 == envelope.ContentSHA256 {
+		if !cfg.force {
+			fmt.Fprintf(status, "Content unchanged (sha256 %s), skipping publish\n", envelope.ContentSHA256)
+			return errUnchanged
+		}
+		envelope.GeneratedAt = prev.GeneratedAt
+	}
 
-	// Write JSON output
-	jsonPath := filepath.Join(outDir, "latest.json")
+	// Write legacy JSON output (bare array)
+	jsonPath := filepath.Join(dir, "latest.json")
 	if err := writeJSON(records, jsonPath); err != nil {
 		return fmt.Errorf("failed to write JSON: %w", err)
 	}
 
-	// Write CSV output
-	csvPath := filepath.Join(outDir, "latest.csv")
-	if err := writeCSV(records, csvPath); err != nil {
-		return fmt.Errorf("failed to write CSV: %w", err)
+	// Write versioned JSON output with metadata envelope
+	if err := os.MkdirAll(filepath.Join(dir, "v2"), 0755); err != nil {
+		return fmt.Errorf("failed to create v2 directory: %w", err)
+	}
+	if err := writeJSON(envelope, filepath.Join(dir, "v2", "latest.json")); err != nil {
+		return fmt.Errorf("failed to write v2 JSON: %w", err)
+	}
+
+	// Write XML output for Excel FILTERXML/WEBSERVICE
+	if err := writeXML(envelope, filepath.Join(dir, "latest.xml"), filepath.Join(dir, "xml")); err != nil {
+		return fmt.Errorf("failed to write XML: %w", err)
+	}
+
+	// Write per-bond and per-family shards with their manifest
+	if err := writeShards(envelope, dir); err != nil {
+		return fmt.Errorf("failed to write shards: %w", err)
+	}
+
+	// Write single-value files for formula-only spreadsheet lookups
+	if err := writeValues(records, filepath.Join(dir, "v")); err != nil {
+		return fmt.Errorf("failed to write value files: %w", err)
+	}
+
+	// Write upstream revisions of past rows
+	if err := writeJSON(revisions, filepath.Join(dir, "revisions.json")); err != nil {
+		return fmt.Errorf("failed to write revisions: %w", err)
+	}
+
+	// Write JSON Schema documents for every JSON output
+	if err := writeSchemas(filepath.Join(dir, "schema")); err != nil {
+		return fmt.Errorf("failed to write schemas: %w", err)
+	}
+
+	// Write CSV outputs, one per dialect
+	for _, out := range append(defaultCSVOutputs, cfg.csvOutputs...) {
+		dialect := out.dialect
+		dialect.decimals = cfg.csvDecimals
+		if err := writeCSVDialect(records, filepath.Join(dir, out.file), dialect); err != nil {
+			return fmt.Errorf("failed to write CSV %s: %w", out.file, err)
+		}
+	}
+	// Write Excel workbook
+	if err := writeXLSX(records, filepath.Join(dir, "tesouro.xlsx")); err != nil {
+		return fmt.Errorf("failed to write XLSX: %w", err)
+	}
+
+	// Write SQLite database with the full price history
+	if err := writeSQLite(latest, filepath.Join(dir, "tesouro.sqlite")); err != nil {
+		return fmt.Errorf("failed to write SQLite: %w", err)
+	}
+	// Write Parquet dataset with the full price history, partitioned by year
+	if err := writeParquet(latest, filepath.Join(dir, "parquet")); err != nil {
+		return fmt.Errorf("failed to write Parquet: %w", err)
+	}
+
+	// Write precompressed variants of every output
+	if cfg.compress {
+		if err := compressOutputs(dir); err != nil {
+			return fmt.Errorf("failed to compress outputs: %w", err)
+		}
+	}
+
+	// Write the checksum list last so it covers every other file
+	if err := writeChecksums(dir, cfg.signingKey); err != nil {
+		return fmt.Errorf("failed to write checksums: %w", err)
+	}
+
+	// Swap the complete set of outputs in
+	if err := publishStaging(dir, cfg.outDir, cfg.keep); err != nil {
+		return fmt.Errorf("failed to publish outputs: %w", err)
 	}
+	report.Timings.Write = stage(&mark)
 
-	fmt.Printf("Successfully processed %d records\n", len(records))
+	fmt.Fprintf(status, "Successfully processed %d records\n", len(records))
 	return nil
 }
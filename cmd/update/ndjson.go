@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+)
+
+const (
+	formatAll    = "all"
+	formatNDJSON = "ndjson"
+)
+
+// ndjsonSink emits one JSON record per line as soon as each record is
+// finalized. When writing to stdout every line is flushed immediately so
+// downstream consumers see records without waiting for the whole file; when
+// writing to a file the output is staged in a temp file and renamed on commit.
+type ndjsonSink struct {
+	buf     *bufio.Writer
+	enc     *json.Encoder
+	file    *os.File // Nil when streaming to stdout
+	path    string
+	tmpPath string
+}
+
+func newStdoutSink(w io.Writer) *ndjsonSink {
+	buf := bufio.NewWriter(w)
+	return &ndjsonSink{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func newFileSink(path string) (*ndjsonSink, error) {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(file)
+	return &ndjsonSink{buf: buf, enc: json.NewEncoder(buf), file: file, path: path, tmpPath: tmpPath}, nil
+}
+
+func (s *ndjsonSink) write(rec Record) error {
+	if err := s.enc.Encode(rec); err != nil {
+		return err
+	}
+	if s.file == nil {
+		return s.buf.Flush()
+	}
+	return nil
+}
+
+// commit flushes the output and, for files, atomically replaces the target.
+func (s *ndjsonSink) commit() error {
+	if err := s.buf.Flush(); err != nil {
+		s.abort()
+		return err
+	}
+	if s.file == nil {
+		return nil
+	}
+
+	if err := s.file.Close(); err != nil {
+		os.Remove(s.tmpPath)
+		return err
+	}
+	if err := os.Rename(s.tmpPath, s.path); err != nil {
+		os.Remove(s.tmpPath)
+		return err
+	}
+	s.file = nil
+	return nil
+}
+
+// abort discards a file output that was not committed. It is a no-op after
+// commit and for stdout.
+func (s *ndjsonSink) abort() {
+	if s.file != nil {
+		s.file.Close()
+		os.Remove(s.tmpPath)
+		s.file = nil
+	}
+}
+
+// historyRecords lists every row of each bond, bonds in the order of records
+// and rows by Data Base, with the bond's start date filled in.
+func historyRecords(latest map[string]*assetRecord, records []Record) []Record {
+	var rows []Record
+	for _, rec := range records {
+		asset := latest[rec.tipoTitulo+"|"+rec.DataVencimento]
+		for _, row := range sortedHistory(asset.history) {
+			row.DataInicio = rec.DataInicio
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNDJSONSinkStdout(t *testing.T) {
+	var out bytes.Buffer
+	sink := newStdoutSink(&out)
+
+	require.NoError(t, sink.write(Record{Nome: "Tesouro IPCA+ 2035"}))
+	// Each record is visible as soon as it is written
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"))
+	require.NoError(t, sink.write(Record{Nome: "Tesouro Selic 2029"}))
+	require.NoError(t, sink.commit())
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	var rec Record
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &rec))
+	assert.Equal(t, "Tesouro Selic 2029", rec.Nome)
+}
+
+func TestNDJSONSinkFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latest.ndjson")
+
+	sink, err := newFileSink(path)
+	require.NoError(t, err)
+	require.NoError(t, sink.write(Record{Nome: "Tesouro IPCA+ 2035"}))
+	sink.abort()
+	assert.NoFileExists(t, path)
+	assert.NoFileExists(t, path+".tmp")
+
+	sink, err = newFileSink(path)
+	require.NoError(t, err)
+	require.NoError(t, sink.write(Record{Nome: "Tesouro IPCA+ 2035"}))
+	require.NoError(t, sink.commit())
+	sink.abort() // No-op after commit
+	assert.FileExists(t, path)
+	assert.NoFileExists(t, path+".tmp")
+}
+
+func TestRunNDJSON(t *testing.T) {
+	body := csvHeader +
+		"Tesouro IPCA+;15/05/2035;19/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n" +
+		"Tesouro Selic;17/03/2029;22/12/2025;0,10;0,12;17000,00;16990,00;16990,00\n" +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,31;7,43;2376,00;2350,00;2350,00\n"
+	srv := newCSVServer(t, body)
+
+	t.Run("latest", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, run(config{url: srv.URL, outDir: dir, maxWarnings: -1, format: formatNDJSON}))
+
+		lines := readLines(t, filepath.Join(dir, "latest.ndjson"))
+		require.Len(t, lines, 2)
+		assert.Contains(t, lines[0], `"nome":"Tesouro IPCA+ 2035"`)
+		assert.Contains(t, lines[0], `"data_base":"2025-12-22"`)
+		assert.Contains(t, lines[1], `"nome":"Tesouro Selic 2029"`)
+
+		// Other outputs are skipped
+		assert.NoFileExists(t, filepath.Join(dir, "latest.json"))
+		assert.FileExists(t, filepath.Join(dir, "run.json"))
+	})
+
+	t.Run("history", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, run(config{url: srv.URL, outDir: dir, maxWarnings: -1, format: formatNDJSON, history: true}))
+
+		// Every row, by bond and Data Base, with the bond's start date
+		lines := readLines(t, filepath.Join(dir, "history.ndjson"))
+		require.Len(t, lines, 3)
+		assert.Contains(t, lines[0], `"data_base":"2025-12-19"`)
+		assert.Contains(t, lines[1], `"data_base":"2025-12-22"`)
+		assert.Contains(t, lines[1], `"data_inicio":"2025-12-19"`)
+		assert.Contains(t, lines[2], `"nome":"Tesouro Selic 2029"`)
+	})
+
+	t.Run("history resolves duplicates", func(t *testing.T) {
+		srv := newCSVServer(t, body+"Tesouro IPCA+;15/05/2035;19/12/2025;7,30;7,42;2375,00;2349,00;2349,00\n")
+		dir := t.TempDir()
+		require.NoError(t, run(config{url: srv.URL, outDir: dir, maxWarnings: -1, format: formatNDJSON, history: true}))
+
+		lines := readLines(t, filepath.Join(dir, "history.ndjson"))
+		require.Len(t, lines, 3)
+		assert.Contains(t, lines[0], `"taxa_compra_manha":7.3,`)
+	})
+
+	t.Run("refuses a full publish directory", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, run(config{url: srv.URL, outDir: dir, maxWarnings: -1}))
+		before := readTree(t, dir)
+
+		err := run(config{url: srv.URL, outDir: dir, maxWarnings: -1, format: formatNDJSON})
+		require.ErrorContains(t, err, "holds a full publish")
+		assert.NoFileExists(t, filepath.Join(dir, "latest.ndjson"))
+		after := readTree(t, dir)
+		delete(before, "run.json")
+		delete(after, "run.json")
+		assert.Equal(t, before, after)
+	})
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig(nil)
+	require.NoError(t, err)
+	assert.Equal(t, defaultURL, cfg.url)
+	assert.Equal(t, formatAll, cfg.format)
+	assert.Equal(t, -1, cfg.maxWarnings)
+
+	cfg, err = parseConfig([]string{"--stdout", "--history"})
+	require.NoError(t, err)
+	assert.Equal(t, formatNDJSON, cfg.format)
+
+	cfg, err = parseConfig([]string{"--csv-decimals", "taxa_compra_manha=2", "--csv", "file=x.csv,lang=en"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"taxa_compra_manha": 2}, cfg.csvDecimals)
+	require.Len(t, cfg.csvOutputs, 1)
+	assert.Equal(t, "x.csv", cfg.csvOutputs[0].file)
+
+	for _, args := range [][]string{
+		{"--format", "xml"},
+		{"--history"},
+		{"--csv-decimals", "nome=2"},
+		{"--csv", "lang=en"},
+		{"--csv", "file=a.csv", "--csv", "file=a.csv,lang=en"},
+		{"--duplicates", "max"},
+		{"--stale-after", "-1"},
+		{"--min-rows", "-1"},
+		{"--max-bond-drop", "150"},
+	} {
+		_, err := parseConfig(args)
+		assert.Error(t, err, strings.Join(args, " "))
+	}
+}
+
+func readLines(t *testing.T, path string) []string {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRow is one bond on one Data Base. Dates are stored as the Parquet
+// DATE logical type (days since the Unix epoch).
+type parquetRow struct {
+	TipoTitulo      string  `parquet:"tipo_titulo,dict"`
+	Nome            string  `parquet:"nome,dict"`
+	DataVencimento  int32   `parquet:"data_vencimento,date"`
+	DataConversao   int32   `parquet:"data_conversao,date,optional"`
+	DataBase        int32   `parquet:"data_base,date"`
+	TaxaCompraManha float64 `parquet:"taxa_compra_manha"`
+	TaxaVendaManha  float64 `parquet:"taxa_venda_manha"`
+	PUCompraManha   float64 `parquet:"pu_compra_manha"`
+	PUVendaManha    float64 `parquet:"pu_venda_manha"`
+	PUBaseManha     float64 `parquet:"pu_base_manha"`
+}
+
+// writeParquet writes the full price history as a Hive-partitioned Parquet
+// dataset under dir, with one file per Data Base year:
+// dir/year=2024/tesouro.parquet.
+func writeParquet(latest map[string]*assetRecord, dir string) error {
+	partitions := map[int][]parquetRow{}
+	for _, asset := range sortedAssets(latest) {
+		for _, rec := range sortedHistory(asset.history) {
+			row, year, err := newParquetRow(rec)
+			if err != nil {
+				return err
+			}
+			partitions[year] = append(partitions[year], row)
+		}
+	}
+
+	return writeParquetPartitions(partitions, dir)
+}
+
+func writeParquetPartitions(partitions map[int][]parquetRow, dir string) error {
+	for year, rows := range partitions {
+		// Order by Data Base, then by bond, within each partition
+		sort.SliceStable(rows, func(i, j int) bool {
+			return rows[i].DataBase < rows[j].DataBase
+		})
+
+		partDir := filepath.Join(dir, "year="+strconv.Itoa(year))
+		if err := os.MkdirAll(partDir, 0755); err != nil {
+			return err
+		}
+		if err := writeParquetFile(rows, filepath.Join(partDir, "tesouro.parquet")); err != nil {
+			return fmt.Errorf("year %d: %w", year, err)
+		}
+	}
+	return nil
+}
+
+func writeParquetFile(rows []parquetRow, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := parquet.NewGenericWriter[parquetRow](file, parquet.Compression(&parquet.Zstd))
+	if _, err := writer.Write(rows); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+func newParquetRow(rec Record) (parquetRow, int, error) {
+	dataBase, err := time.Parse("2006-01-02", rec.DataBase)
+	if err != nil {
+		return parquetRow{}, 0, fmt.Errorf("invalid Data Base %q: %w", rec.DataBase, err)
+	}
+	vencimento, err := parquetDate(rec.DataVencimento)
+	if err != nil {
+		return parquetRow{}, 0, fmt.Errorf("invalid Data Vencimento %q: %w", rec.DataVencimento, err)
+	}
+	var conversao int32
+	if rec.DataConversao != "" {
+		if conversao, err = parquetDate(rec.DataConversao); err != nil {
+			return parquetRow{}, 0, fmt.Errorf("invalid Data Conversao %q: %w", rec.DataConversao, err)
+		}
+	}
+
+	return parquetRow{
+		TipoTitulo:      rec.tipoTitulo,
+		Nome:            rec.Nome,
+		DataVencimento:  vencimento,
+		DataConversao:   conversao,
+		DataBase:        int32(dataBase.Unix() / 86400),
+		TaxaCompraManha: rec.TaxaCompraManha,
+		TaxaVendaManha:  rec.TaxaVendaManha,
+		PUCompraManha:   rec.PUCompraManha,
+		PUVendaManha:    rec.PUVendaManha,
+		PUBaseManha:     rec.PUBaseManha,
+	}, dataBase.Year(), nil
+}
+
+// parquetDate converts an ISO date to days since the Unix epoch.
+func parquetDate(s string) (int32, error) {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return 0, err
+	}
+	return int32(t.Unix() / 86400), nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteParquet(t *testing.T) {
+	csv := csvHeader +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,31;7,43;2376,00;2350,00;2350,00\n" +
+		"Tesouro IPCA+;15/05/2035;30/12/2024;7,29;7,41;2374,37;2348,76;2348,76\n" +
+		"Tesouro Educa+;15/12/2034;22/12/2025;5,36;5,48;2587,63;2556,12;2556,12\n"
+	latest, err := parseCSV(strings.NewReader(csv))
+	require.NoError(t, err)
+
+	dir := filepath.Join(t.TempDir(), "parquet")
+
+	require.NoError(t, writeParquet(latest, dir))
+
+	rows2024, err := parquet.ReadFile[parquetRow](filepath.Join(dir, "year=2024", "tesouro.parquet"))
+	require.NoError(t, err)
+	require.Len(t, rows2024, 1)
+	assert.Equal(t, "Tesouro IPCA+ 2035", rows2024[0].Nome)
+	assert.InDelta(t, 7.29, rows2024[0].TaxaCompraManha, 0.0001)
+
+	rows2025, err := parquet.ReadFile[parquetRow](filepath.Join(dir, "year=2025", "tesouro.parquet"))
+	require.NoError(t, err)
+	require.Len(t, rows2025, 2)
+
+	// Sorted by bond within the same Data Base
+	assert.Equal(t, "Tesouro Educa+", rows2025[0].TipoTitulo)
+	conversao, err := parquetDate("2030-01-15")
+	require.NoError(t, err)
+	assert.Equal(t, conversao, rows2025[0].DataConversao)
+	assert.Zero(t, rows2025[1].DataConversao)
+
+	dataBase, err := parquetDate("2025-12-22")
+	require.NoError(t, err)
+	assert.Equal(t, dataBase, rows2025[1].DataBase)
+
+	// Columns carry the DATE logical type
+	file, err := os.Open(filepath.Join(dir, "year=2025", "tesouro.parquet"))
+	require.NoError(t, err)
+	defer file.Close()
+	stat, err := file.Stat()
+	require.NoError(t, err)
+	pf, err := parquet.OpenFile(file, stat.Size())
+	require.NoError(t, err)
+	column, ok := pf.Schema().Lookup("data_base")
+	require.True(t, ok)
+	assert.Equal(t, parquet.Date().Type(), column.Node.Type())
+}
+
+func TestParquetDate(t *testing.T) {
+	days, err := parquetDate("1970-01-02")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), days)
+
+	_, err = parquetDate("02/01/1970")
+	assert.Error(t, err)
+}
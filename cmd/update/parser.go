@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -11,7 +12,70 @@ import (
 	"time"
 )
 
+const (
+	diagShortRow      = "short_row"
+	diagInvalidDate   = "invalid_date"
+	diagInvalidNumber = "invalid_number"
+)
+
+// parseDiagnostic describes a row that could not be fully parsed.
+type parseDiagnostic struct {
+	Line    int    `json:"line"`
+	Column  string `json:"column,omitempty"`
+	Raw     string `json:"raw"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// parseReport counts the data rows seen by the parser. Every row read is
+// either parsed, skipped (a field failed to parse) or short (too few fields).
+// Parsed rows include duplicates of an earlier row's bond and Data Base.
+type parseReport struct {
+	RowsRead      int               `json:"rows_read"`
+	RowsParsed    int               `json:"rows_parsed"`
+	RowsSkipped   int               `json:"rows_skipped"`
+	RowsShort     int               `json:"rows_short"`
+	RowsDuplicate int               `json:"rows_duplicate"`
+	Warnings      []parseDiagnostic `json:"warnings"`
+	Duplicates    []duplicateRow    `json:"duplicates"` // Duplicates with different values
+	quiet         bool              // Collect warnings without printing them
+}
+
+func (r *parseReport) warn(d parseDiagnostic) {
+	if !r.quiet {
+		fmt.Fprintf(os.Stderr, "Warning: line %d: %s\n", d.Line, d.Message)
+	}
+	r.Warnings = append(r.Warnings, d)
+}
+
+// fieldError is returned by parseRecord when a single column fails to parse.
+type fieldError struct {
+	column string
+	raw    string
+	kind   string
+	err    error
+}
+
+func (e *fieldError) Error() string {
+	return fmt.Sprintf("failed to parse %s: %v", e.column, e.err)
+}
+
+func (e *fieldError) Unwrap() error {
+	return e.err
+}
+
+type csvParser struct {
+	report     parseReport
+	duplicates string             // Duplicates policy, "last" when empty
+	onRow      func(Record) error // Optional: called for every parsed row, in file order
+}
+
 func parseCSV(r io.Reader) (map[string]*assetRecord, error) {
+	var p csvParser
+	return p.parse(r)
+}
+
+func (p *csvParser) parse(r io.Reader) (map[string]*assetRecord, error) {
 	br := bufio.NewReader(r)
 	csvReader := csv.NewReader(br)
 	csvReader.Comma = ';'
@@ -35,7 +99,7 @@ func parseCSV(r io.Reader) (map[string]*assetRecord, error) {
 	}
 
 	latest := make(map[string]*assetRecord)
-	lineNum := 2 // Start at 2 (header is line 1)
+	rows := make(map[string]*seenRow) // Keyed by asset key and Data Base
 
 	for {
 		row, err := csvReader.Read()
@@ -43,18 +107,33 @@ func parseCSV(r io.Reader) (map[string]*assetRecord, error) {
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("error reading line %d: %w", lineNum, err)
+			return nil, fmt.Errorf("error reading CSV: %w", err)
 		}
+		lineNum, _ := csvReader.FieldPos(0)
+		p.report.RowsRead++
 
 		if len(row) < 8 {
-			continue // Skip incomplete rows
+			// Skip incomplete rows
+			p.report.RowsShort++
+			p.report.warn(parseDiagnostic{
+				Line:    lineNum,
+				Raw:     strings.Join(row, ";"),
+				Kind:    diagShortRow,
+				Message: fmt.Sprintf("expected 8 fields, got %d", len(row)),
+			})
+			continue
 		}
 
 		record, err := parseRecord(row)
 		if err != nil {
-			// Log but continue processing
-			fmt.Fprintf(os.Stderr, "Warning: failed to parse line %d: %v\n", lineNum, err)
-			lineNum++
+			// Record but continue processing
+			p.report.RowsSkipped++
+			d := parseDiagnostic{Line: lineNum, Raw: strings.Join(row, ";"), Message: err.Error()}
+			var fe *fieldError
+			if errors.As(err, &fe) {
+				d.Column, d.Raw, d.Kind = fe.column, fe.raw, fe.kind
+			}
+			p.report.warn(d)
 			continue
 		}
 
@@ -64,36 +143,81 @@ func parseCSV(r io.Reader) (map[string]*assetRecord, error) {
 		// Parse data base for comparison
 		dataBase, err := time.Parse("2006-01-02", record.DataBase)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to parse data base on line %d: %v\n", lineNum, err)
-			lineNum++
+			p.report.RowsSkipped++
+			p.report.warn(parseDiagnostic{
+				Line:    lineNum,
+				Column:  "Data Base",
+				Raw:     record.DataBase,
+				Kind:    diagInvalidDate,
+				Message: fmt.Sprintf("failed to parse data base: %v", err),
+			})
+			continue
+		}
+		p.report.RowsParsed++
+
+		// Resolve a row for an already seen bond and Data Base in place. A
+		// row whose values change is emitted again, superseding the first.
+		rowKey := assetKey + "|" + record.DataBase
+		if seen, exists := rows[rowKey]; exists {
+			existing := latest[assetKey]
+			resolved, changed, err := p.resolveDuplicate(seen, existing.history[seen.index], record, lineNum)
+			if err != nil {
+				return nil, err
+			}
+			if changed {
+				existing.history[seen.index] = resolved
+				if existing.record.DataBase == resolved.DataBase {
+					existing.record = resolved
+				}
+				if err := p.emit(resolved, lineNum); err != nil {
+					return nil, err
+				}
+			}
 			continue
 		}
 
+		if err := p.emit(record, lineNum); err != nil {
+			return nil, err
+		}
+
 		// Track latest record per asset key and minimum Data Base (start date)
 		if existing, exists := latest[assetKey]; !exists {
+			rows[rowKey] = newSeenRow(record, lineNum, 0)
 			latest[assetKey] = &assetRecord{
 				dataBaseMax: dataBase,
 				dataBaseMin: dataBase,
 				record:      record,
+				history:     []Record{record},
 			}
 		} else {
+			rows[rowKey] = newSeenRow(record, lineNum, len(existing.history))
+			existing.history = append(existing.history, record)
 			// Update minimum if this record has an older Data Base
 			if dataBase.Before(existing.dataBaseMin) {
 				existing.dataBaseMin = dataBase
 			}
 			// Update record if this is a newer Data Base
-			if !dataBase.Before(existing.dataBaseMax) {
+			if dataBase.After(existing.dataBaseMax) {
 				existing.dataBaseMax = dataBase
 				existing.record = record
 			}
 		}
-
-		lineNum++
 	}
 
 	return latest, nil
 }
 
+// emit passes a parsed row to onRow, if set.
+func (p *csvParser) emit(rec Record, lineNum int) error {
+	if p.onRow == nil {
+		return nil
+	}
+	if err := p.onRow(rec); err != nil {
+		return fmt.Errorf("failed to emit line %d: %w", lineNum, err)
+	}
+	return nil
+}
+
 func parseRecord(row []string) (Record, error) {
 	var rec Record
 	var err error
@@ -103,38 +227,38 @@ func parseRecord(row []string) (Record, error) {
 	// Parse dates (dd/mm/yyyy -> ISO yyyy-mm-dd)
 	rec.DataVencimento, err = parseDate(row[1])
 	if err != nil {
-		return rec, fmt.Errorf("failed to parse Data Vencimento: %w", err)
+		return rec, &fieldError{column: "Data Vencimento", raw: row[1], kind: diagInvalidDate, err: err}
 	}
 
 	rec.DataBase, err = parseDate(row[2])
 	if err != nil {
-		return rec, fmt.Errorf("failed to parse Data Base: %w", err)
+		return rec, &fieldError{column: "Data Base", raw: row[2], kind: diagInvalidDate, err: err}
 	}
 
 	// Parse float values (PT-BR format: comma as decimal separator)
 	rec.TaxaCompraManha, err = parseFloatBR(row[3])
 	if err != nil {
-		return rec, fmt.Errorf("failed to parse Taxa Compra Manha: %w", err)
+		return rec, &fieldError{column: "Taxa Compra Manha", raw: row[3], kind: diagInvalidNumber, err: err}
 	}
 
 	rec.TaxaVendaManha, err = parseFloatBR(row[4])
 	if err != nil {
-		return rec, fmt.Errorf("failed to parse Taxa Venda Manha: %w", err)
+		return rec, &fieldError{column: "Taxa Venda Manha", raw: row[4], kind: diagInvalidNumber, err: err}
 	}
 
 	rec.PUCompraManha, err = parseFloatBR(row[5])
 	if err != nil {
-		return rec, fmt.Errorf("failed to parse PU Compra Manha: %w", err)
+		return rec, &fieldError{column: "PU Compra Manha", raw: row[5], kind: diagInvalidNumber, err: err}
 	}
 
 	rec.PUVendaManha, err = parseFloatBR(row[6])
 	if err != nil {
-		return rec, fmt.Errorf("failed to parse PU Venda Manha: %w", err)
+		return rec, &fieldError{column: "PU Venda Manha", raw: row[6], kind: diagInvalidNumber, err: err}
 	}
 
 	rec.PUBaseManha, err = parseFloatBR(row[7])
 	if err != nil {
-		return rec, fmt.Errorf("failed to parse PU Base Manha: %w", err)
+		return rec, &fieldError{column: "PU Base Manha", raw: row[7], kind: diagInvalidNumber, err: err}
 	}
 
 	// Compute combined name: tipo_titulo + year
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// defaultKeepGenerations is how many previous output directories are kept
+// for rollback.
+const defaultKeepGenerations = 2
+
+// stagingDir is the sibling directory a run writes its outputs to before they
+// are swapped in.
+func stagingDir(outDir string) string {
+	return filepath.Clean(outDir) + ".staging"
+}
+
+// generationDir is the n-th previous output directory: public.prev-1 is the
+// one replaced by the last successful run.
+func generationDir(outDir string, n int) string {
+	return fmt.Sprintf("%s.prev-%d", filepath.Clean(outDir), n)
+}
+
+// newStagingDir creates an empty staging directory, discarding leftovers from
+// an interrupted run.
+func newStagingDir(outDir string) (string, error) {
+	dir := stagingDir(outDir)
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	return dir, os.MkdirAll(dir, 0755)
+}
+
+// removeOutput deletes a file written to the live directory after the swap,
+// along with its compressed variants.
+func removeOutput(path string) error {
+	for _, p := range []string{path, path + ".gz", path + ".br"} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishStaging swaps the staging directory in as outDir. The swap takes two
+// renames, so for a moment between them outDir does not exist: readers see the
+// old directory, the new one or none at all, never a mix of both. Only once the
+// swap has succeeded does the replaced directory become generation 1, with
+// older generations shifting up and at most keep of them kept, so a failed
+// swap leaves every generation as it was.
+func publishStaging(staging, outDir string, keep int) error {
+	outDir = filepath.Clean(outDir)
+
+	// A leftover from an interrupted run is discarded
+	prev := outDir + ".old"
+	if err := os.RemoveAll(prev); err != nil {
+		return err
+	}
+	replaced := true
+	if err := os.Rename(outDir, prev); os.IsNotExist(err) {
+		replaced = false
+	} else if err != nil {
+		return err
+	}
+	if err := os.Rename(staging, outDir); err != nil {
+		if replaced {
+			os.Rename(prev, outDir)
+		}
+		return err
+	}
+
+	if !replaced {
+		return nil
+	}
+	if keep == 0 {
+		return os.RemoveAll(prev)
+	}
+	if err := rotateGenerations(outDir, prev, keep); err != nil {
+		return fmt.Errorf("published, but failed to keep the previous generation: %w", err)
+	}
+	return nil
+}
+
+// rotateGenerations shifts the generations of outDir up by one, dropping the
+// oldest beyond keep, and moves prev in as generation 1.
+func rotateGenerations(outDir, prev string, keep int) error {
+	if err := os.RemoveAll(generationDir(outDir, keep)); err != nil {
+		return err
+	}
+	for n := keep - 1; n >= 1; n-- {
+		if err := os.Rename(generationDir(outDir, n), generationDir(outDir, n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(prev, generationDir(outDir, 1))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// publishRun stages a directory holding a single marker file and publishes it.
+func publishRun(t *testing.T, outDir, marker string, keep int) {
+	t.Helper()
+	staging, err := newStagingDir(outDir)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(staging, "run"), []byte(marker), 0644))
+	require.NoError(t, publishStaging(staging, outDir, keep))
+}
+
+func readMarker(t *testing.T, dir string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "run"))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestPublishStagingKeepsGenerations(t *testing.T) {
+	outDir := filepath.Join(t.TempDir(), "public")
+
+	for _, marker := range []string{"1", "2", "3", "4"} {
+		publishRun(t, outDir, marker, 2)
+	}
+
+	assert.Equal(t, "4", readMarker(t, outDir))
+	assert.Equal(t, "3", readMarker(t, generationDir(outDir, 1)))
+	assert.Equal(t, "2", readMarker(t, generationDir(outDir, 2)))
+	assert.NoDirExists(t, generationDir(outDir, 3))
+	assert.NoDirExists(t, stagingDir(outDir))
+}
+
+func TestPublishStagingFailedSwapKeepsGenerations(t *testing.T) {
+	outDir := filepath.Join(t.TempDir(), "public")
+	publishRun(t, outDir, "1", 2)
+	publishRun(t, outDir, "2", 2)
+
+	err := publishStaging(stagingDir(outDir), outDir, 2)
+	require.Error(t, err)
+
+	assert.Equal(t, "2", readMarker(t, outDir))
+	assert.Equal(t, "1", readMarker(t, generationDir(outDir, 1)))
+	assert.NoDirExists(t, generationDir(outDir, 2))
+	assert.NoDirExists(t, outDir+".old")
+}
+
+func TestPublishStagingWithoutGenerations(t *testing.T) {
+	outDir := filepath.Join(t.TempDir(), "public")
+
+	publishRun(t, outDir, "1", 0)
+	publishRun(t, outDir, "2", 0)
+
+	assert.Equal(t, "2", readMarker(t, outDir))
+	assert.NoDirExists(t, generationDir(outDir, 1))
+	assert.NoDirExists(t, outDir+".old")
+}
+
+func TestNewStagingDirDiscardsLeftovers(t *testing.T) {
+	outDir := filepath.Join(t.TempDir(), "public")
+	require.NoError(t, os.MkdirAll(stagingDir(outDir), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(stagingDir(outDir), "stale.json"), []byte("{}"), 0644))
+
+	staging, err := newStagingDir(outDir)
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(staging)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	statusOK        = "ok"
+	statusFailed    = "failed"
+	statusUnchanged = "unchanged"
+)
+
+// runReport is published as run.json after every run, successful or not.
+type runReport struct {
+	SourceURL     string     `json:"source_url"`
+	StartedAt     string     `json:"started_at"`
+	FinishedAt    string     `json:"finished_at"`
+	Status        string     `json:"status"`
+	Error         string     `json:"error,omitempty"`
+	Records       int        `json:"records"`
+	Anomalies     int        `json:"anomalies"`
+	Revisions     int        `json:"revisions"`
+	ContentSHA256 string     `json:"content_sha256,omitempty"`
+	CacheHit      bool       `json:"cache_hit"`
+	Incremental   bool       `json:"incremental"`      // The source was assembled from the cache plus appended bytes
+	Health        string     `json:"health,omitempty"` // Status in health.json, when the data was checked
+	Timings       runTimings `json:"timings_ms"`
+	parseReport
+	health   *healthReport // Published as health.json
+	rejected []Anomaly     // Published as anomalies.rejected.json when --strict refuses the data
+}
+
+// runTimings holds the duration of each stage in milliseconds. Without the
+// raw cache, the download stage only covers the response headers, since the
+// body is streamed into the parser.
+type runTimings struct {
+	Download int64 `json:"download"`
+	Parse    int64 `json:"parse"`
+	Validate int64 `json:"validate"`
+	Write    int64 `json:"write"`
+	Total    int64 `json:"total"`
+}
+
+func newRunReport(sourceURL string, start time.Time) *runReport {
+	return &runReport{
+		SourceURL: sourceURL,
+		StartedAt: start.UTC().Format(time.RFC3339),
+		Status:    statusOK,
+		parseReport: parseReport{
+			Warnings:   []parseDiagnostic{},
+			Duplicates: []duplicateRow{},
+		},
+	}
+}
+
+// stage returns the milliseconds elapsed since *mark and moves the mark forward.
+func stage(mark *time.Time) int64 {
+	now := time.Now()
+	elapsed := now.Sub(*mark).Milliseconds()
+	*mark = now
+	return elapsed
+}
+
+func (r *runReport) finish(start time.Time, err error) {
+	end := time.Now()
+	r.FinishedAt = end.UTC().Format(time.RFC3339)
+	r.Timings.Total = end.Sub(start).Milliseconds()
+	switch {
+	case errors.Is(err, errUnchanged):
+		r.Status = statusUnchanged
+	case err != nil:
+		r.Status = statusFailed
+		r.Error = err.Error()
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// revisionReport is published as revisions.json: the past rows the Treasury
+// changed, inserted or deleted since the upstream file behind the published
+// snapshot.
+type revisionReport struct {
+	PreviousSHA256    string        `json:"previous_sha256"`     // Archived file compared against; empty when there was none
+	PreviousFetchedAt string        `json:"previous_fetched_at"` // RFC 3339, UTC
+	Changed           []rowRevision `json:"changed"`
+	Inserted          []rowRevision `json:"inserted"` // New rows dated on or before the previous file's latest Data Base
+	Deleted           []rowRevision `json:"deleted"`
+}
+
+// rowRevision is one revised row, identified by bond and Data Base. Old is
+// omitted for inserted rows and New for deleted ones.
+type rowRevision struct {
+	Nome           string     `json:"nome"`
+	TipoTitulo     string     `json:"tipo_titulo"`
+	DataVencimento string     `json:"data_vencimento" schema:"date"`
+	DataBase       string     `json:"data_base" schema:"date"`
+	Old            *rowValues `json:"old,omitempty"`
+	New            *rowValues `json:"new,omitempty"`
+}
+
+type rowValues struct {
+	TaxaCompraManha float64 `json:"taxa_compra_manha"`
+	TaxaVendaManha  float64 `json:"taxa_venda_manha"`
+	PUCompraManha   float64 `json:"pu_compra_manha"`
+	PUVendaManha    float64 `json:"pu_venda_manha"`
+	PUBaseManha     float64 `json:"pu_base_manha"`
+}
+
+func newRowValues(rec Record) *rowValues {
+	return &rowValues{
+		TaxaCompraManha: rec.TaxaCompraManha,
+		TaxaVendaManha:  rec.TaxaVendaManha,
+		PUCompraManha:   rec.PUCompraManha,
+		PUVendaManha:    rec.PUVendaManha,
+		PUBaseManha:     rec.PUBaseManha,
+	}
+}
+
+func (r revisionReport) count() int {
+	return len(r.Changed) + len(r.Inserted) + len(r.Deleted)
+}
+
+// compareWithArchive compares the parsed rows with the archived file with hash
+// base, usually the source of the published snapshot, resolving its
+// duplicates the same way. Without such a file the report is empty.
+func compareWithArchive(latest map[string]*assetRecord, archiveDir, base, duplicates string) (revisionReport, error) {
+	report := detectRevisions(nil, latest)
+	if base == "" {
+		return report, nil
+	}
+
+	index, err := readArchiveIndex(archiveDir)
+	if err != nil {
+		return report, err
+	}
+	var prev *archiveEntry
+	for i, e := range index.Entries {
+		if e.SHA256 == base {
+			prev = &index.Entries[i]
+		}
+	}
+	if prev == nil {
+		return report, nil
+	}
+
+	previous, err := parseArchived(filepath.Join(archiveDir, prev.Path), duplicates)
+	if err != nil {
+		return report, fmt.Errorf("archived file %s: %w", prev.SHA256, err)
+	}
+	report = detectRevisions(previous, latest)
+	report.PreviousSHA256 = prev.SHA256
+	report.PreviousFetchedAt = prev.FetchedAt
+	return report, nil
+}
+
+// publishedRevisionsBase returns previous_sha256 from the published
+// revisions.json, or "" when there is none.
+func publishedRevisionsBase(outDir string) string {
+	var report revisionReport
+	data, err := os.ReadFile(filepath.Join(outDir, "revisions.json"))
+	if err != nil || json.Unmarshal(data, &report) != nil {
+		return ""
+	}
+	return report.PreviousSHA256
+}
+
+func parseArchived(path, duplicates string) (map[string]*assetRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Its warnings were reported when it was first parsed, and a conflict
+	// that failed that run should not fail this one
+	if duplicates == duplicatesError {
+		duplicates = duplicatesLast
+	}
+	p := csvParser{report: parseReport{quiet: true}, duplicates: duplicates}
+	return p.parse(zr)
+}
+
+// detectRevisions compares every row of prev with cur, keyed by bond and Data
+// Base. Rows in cur after the latest Data Base of prev are new data, not
+// revisions.
+func detectRevisions(prev, cur map[string]*assetRecord) revisionReport {
+	report := revisionReport{Changed: []rowRevision{}, Inserted: []rowRevision{}, Deleted: []rowRevision{}}
+	prevRows, curRows := rowsByKey(prev), rowsByKey(cur)
+	prevMax := latestDataBase(prev)
+
+	for key, old := range prevRows {
+		rec, ok := curRows[key]
+		switch {
+		case !ok:
+			report.Deleted = append(report.Deleted, newRowRevision(old, newRowValues(old), nil))
+		case *newRowValues(old) != *newRowValues(rec):
+			report.Changed = append(report.Changed, newRowRevision(rec, newRowValues(old), newRowValues(rec)))
+		}
+	}
+	for key, rec := range curRows {
+		if _, ok := prevRows[key]; !ok && rec.DataBase <= prevMax {
+			report.Inserted = append(report.Inserted, newRowRevision(rec, nil, newRowValues(rec)))
+		}
+	}
+
+	for _, revisions := range [][]rowRevision{report.Changed, report.Inserted, report.Deleted} {
+		sort.Slice(revisions, func(i, j int) bool {
+			a, b := revisions[i], revisions[j]
+			if a.TipoTitulo != b.TipoTitulo {
+				return a.TipoTitulo < b.TipoTitulo
+			}
+			if a.DataVencimento != b.DataVencimento {
+				return a.DataVencimento < b.DataVencimento
+			}
+			return a.DataBase < b.DataBase
+		})
+	}
+	return report
+}
+
+func newRowRevision(rec Record, old, new *rowValues) rowRevision {
+	return rowRevision{
+		Nome:           rec.Nome,
+		TipoTitulo:     rec.tipoTitulo,
+		DataVencimento: rec.DataVencimento,
+		DataBase:       rec.DataBase,
+		Old:            old,
+		New:            new,
+	}
+}
+
+// rowsByKey indexes every parsed row by bond and Data Base.
+func rowsByKey(latest map[string]*assetRecord) map[string]Record {
+	rows := map[string]Record{}
+	for key, asset := range latest {
+		for _, rec := range asset.history {
+			rows[key+"|"+rec.DataBase] = rec
+		}
+	}
+	return rows
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectRevisions(t *testing.T) {
+	parse := func(body string) map[string]*assetRecord {
+		p := csvParser{report: parseReport{quiet: true}}
+		latest, err := p.parse(strings.NewReader(csvHeader + body))
+		require.NoError(t, err)
+		return latest
+	}
+	prev := parse(
+		"Tesouro IPCA+;15/05/2035;18/12/2025;7,30;7,42;2370,00;2345,00;2345,00\n" +
+			"Tesouro IPCA+;15/05/2035;19/12/2025;7,30;7,42;2370,00;2345,00;2345,00\n" +
+			"Tesouro Selic;17/03/2029;19/12/2025;0,10;0,12;17000,00;16990,00;16990,00\n")
+	cur := parse(
+		"Tesouro IPCA+;15/05/2035;19/12/2025;7,31;7,42;2370,00;2345,00;2345,00\n" +
+			"Tesouro Selic;17/03/2029;17/12/2025;0,10;0,12;16990,00;16980,00;16980,00\n" +
+			"Tesouro Selic;17/03/2029;19/12/2025;0,10;0,12;17000,00;16990,00;16990,00\n" +
+			"Tesouro Selic;17/03/2029;22/12/2025;0,10;0,12;17010,00;17000,00;17000,00\n")
+
+	report := detectRevisions(prev, cur)
+
+	require.Len(t, report.Changed, 1)
+	changed := report.Changed[0]
+	assert.Equal(t, "Tesouro IPCA+ 2035", changed.Nome)
+	assert.Equal(t, "2025-12-19", changed.DataBase)
+	assert.Equal(t, 7.30, changed.Old.TaxaCompraManha)
+	assert.Equal(t, 7.31, changed.New.TaxaCompraManha)
+
+	// The 22nd is after the previous file's last Data Base: new data
+	require.Len(t, report.Inserted, 1)
+	assert.Equal(t, "2025-12-17", report.Inserted[0].DataBase)
+	assert.Nil(t, report.Inserted[0].Old)
+
+	require.Len(t, report.Deleted, 1)
+	assert.Equal(t, "2025-12-18", report.Deleted[0].DataBase)
+	assert.Nil(t, report.Deleted[0].New)
+	assert.Equal(t, 3, report.count())
+
+	assert.Zero(t, detectRevisions(cur, cur).count())
+}
+
+func TestRunReportsRevisions(t *testing.T) {
+	first := csvHeader +
+		"Tesouro IPCA+;15/05/2035;19/12/2025;7,30;7,42;2370,00;2345,00;2345,00\n"
+	second := csvHeader +
+		"Tesouro IPCA+;15/05/2035;19/12/2025;7,35;7,47;2365,00;2340,00;2340,00\n" +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n"
+	root := t.TempDir()
+	outDir := filepath.Join(root, "public")
+	archiveDir := filepath.Join(root, "archive")
+
+	readRevisions := func() revisionReport {
+		data, err := os.ReadFile(filepath.Join(outDir, "revisions.json"))
+		require.NoError(t, err)
+		var report revisionReport
+		require.NoError(t, json.Unmarshal(data, &report))
+		return report
+	}
+
+	cfg := config{url: newCSVServer(t, first).URL, outDir: outDir, archiveDir: archiveDir, maxWarnings: -1,
+		asOf: time.Date(2025, 12, 19, 21, 0, 0, 0, time.UTC)}
+	require.NoError(t, run(cfg))
+	report := readRevisions()
+	assert.Empty(t, report.PreviousSHA256)
+	assert.Zero(t, report.count())
+
+	cfg.url = newCSVServer(t, second).URL
+	cfg.asOf = time.Date(2025, 12, 22, 21, 0, 0, 0, time.UTC)
+	require.NoError(t, run(cfg))
+	report = readRevisions()
+	index, err := readArchiveIndex(archiveDir)
+	require.NoError(t, err)
+	assert.Equal(t, index.Entries[0].SHA256, report.PreviousSHA256)
+	assert.Equal(t, "2025-12-19T21:00:00Z", report.PreviousFetchedAt)
+	require.Len(t, report.Changed, 1)
+	assert.Equal(t, 2370.00, report.Changed[0].Old.PUCompraManha)
+	assert.Equal(t, 2365.00, report.Changed[0].New.PUCompraManha)
+	assert.Empty(t, report.Inserted)
+	assert.Empty(t, report.Deleted)
+
+	data, err := os.ReadFile(filepath.Join(outDir, "run.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"revisions": 1`)
+
+	// A rerun on the same file still compares against the one before it
+	cfg.asOf = time.Date(2025, 12, 23, 21, 0, 0, 0, time.UTC)
+	cfg.force = true
+	require.NoError(t, run(cfg))
+	assert.Len(t, readRevisions().Changed, 1)
+
+	// A refused file is archived but never published, so the next file is
+	// compared with the published one
+	refused := second + "Tesouro IPCA+;15/05/2035;23/12/2025;7,28;7,40;0,00;2349,00;2349,00\n"
+	cfg.url = newCSVServer(t, refused).URL
+	cfg.strict = true
+	require.Error(t, run(cfg))
+
+	third := second + "Tesouro IPCA+;15/05/2035;23/12/2025;7,28;7,40;2375,00;2349,00;2349,00\n"
+	cfg.url = newCSVServer(t, third).URL
+	require.NoError(t, run(cfg))
+	report = readRevisions()
+	index, err = readArchiveIndex(archiveDir)
+	require.NoError(t, err)
+	require.Len(t, index.Entries, 4)
+	assert.Equal(t, index.Entries[1].SHA256, report.PreviousSHA256)
+	assert.Zero(t, report.count())
+}
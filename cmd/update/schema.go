@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Patterns for string fields tagged with `schema:"date"` or `schema:"date-or-empty"`
+const (
+	datePattern        = `^\d{4}-\d{2}-\d{2}$`
+	dateOrEmptyPattern = `^(\d{4}-\d{2}-\d{2})?$`
+)
+
+// schemaPatterns holds every pattern jsonSchema emits, compiled once, so
+// validation does not compile a regexp per string value.
+var schemaPatterns = map[string]*regexp.Regexp{
+	datePattern:        regexp.MustCompile(datePattern),
+	dateOrEmptyPattern: regexp.MustCompile(dateOrEmptyPattern),
+}
+
+// publishedSchemas lists the JSON documents published under schema/, keyed by
+// file name (without the .schema.json suffix), with a value of the Go type
+// each published file is encoded from. Files with the same shape reuse an
+// entry: bonds/<id>.json follows record, familias/<familia>.json follows
+// latest and anomalies.rejected.json follows anomalies.
+var publishedSchemas = []struct {
+	name  string
+	title string
+	value any
+}{
+	{"record", "Tesouro Direto record", Record{}},
+	{"latest", "latest.json", []Record{}},
+	{"v2-latest", "v2/latest.json", latestEnvelope{}},
+	{"anomalies", "anomalies.json", []Anomaly{}},
+	{"run", "run.json", runReport{}},
+	{"manifest", "manifest.json", manifest{}},
+	{"revisions", "revisions.json", revisionReport{}},
+	{"health", "health.json", healthReport{}},
+	{"archive-index", "archive/index.json", archiveIndex{}},
+}
+
+// jsonSchema builds a JSON Schema document for the Go type of v.
+func jsonSchema(v any, title string) map[string]any {
+	schema := schemaForType(reflect.TypeOf(v))
+	schema["$schema"] = jsonSchemaDraft
+	if title != "" {
+		schema["title"] = title
+	}
+	return schema
+}
+
+func schemaForType(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaForType(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaForType(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaForType(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]any{}
+		required := []string{}
+		addStructFields(t, properties, &required)
+		sort.Strings(required)
+		return map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	default:
+		// Interfaces accept any value
+		return map[string]any{}
+	}
+}
+
+// addStructFields adds the JSON-visible fields of t, flattening embedded
+// structs the same way encoding/json does.
+func addStructFields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && tag == "" {
+			addStructFields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := schemaForType(field.Type)
+		switch field.Tag.Get("schema") {
+		case "date":
+			prop["format"] = "date"
+			prop["pattern"] = datePattern
+		case "date-or-empty":
+			prop["pattern"] = dateOrEmptyPattern
+		}
+		properties[name] = prop
+
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// validateJSON checks a decoded JSON value against the subset of JSON Schema
+// produced by jsonSchema.
+func validateJSON(schema map[string]any, value any) error {
+	return validateAt(schema, value, "$")
+}
+
+func validateAt(schema map[string]any, value any, path string) error {
+	if typ, ok := schema["type"].(string); ok {
+		if !matchesType(typ, value) {
+			return fmt.Errorf("%s: expected %s, got %s", path, typ, jsonTypeName(value))
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, ok := schemaPatterns[pattern]
+			if !ok {
+				return fmt.Errorf("%s: unsupported pattern %q", path, pattern)
+			}
+			if !re.MatchString(v) {
+				return fmt.Errorf("%s: %q does not match pattern %s", path, v, pattern)
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				if err := validateAt(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		for _, name := range stringList(schema["required"]) {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			propPath := path + "." + k
+			if prop, ok := properties[k].(map[string]any); ok {
+				if err := validateAt(prop, v[k], propPath); err != nil {
+					return err
+				}
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					return fmt.Errorf("%s: unexpected property", propPath)
+				}
+			case map[string]any:
+				if err := validateAt(extra, v[k], propPath); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func matchesType(typ string, value any) bool {
+	switch typ {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == float64(int64(f))
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// stringList converts the "required" keyword, which is []string when built by
+// jsonSchema and []any when decoded from JSON.
+func stringList(v any) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []any:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSchemaRecord(t *testing.T) {
+	schema := jsonSchema(Record{}, "record")
+
+	assert.Equal(t, jsonSchemaDraft, schema["$schema"])
+	assert.Equal(t, "object", schema["type"])
+	assert.Equal(t, false, schema["additionalProperties"])
+
+	properties := schema["properties"].(map[string]any)
+	assert.Len(t, properties, 10) // tipoTitulo is internal
+	assert.Equal(t, "number", properties["taxa_compra_manha"].(map[string]any)["type"])
+	assert.Equal(t, datePattern, properties["data_base"].(map[string]any)["pattern"])
+	assert.Equal(t, dateOrEmptyPattern, properties["data_conversao"].(map[string]any)["pattern"])
+	assert.Contains(t, schema["required"], "nome")
+}
+
+func TestJSONSchemaFlattensEmbeddedStructs(t *testing.T) {
+	schema := jsonSchema(runReport{}, "")
+	properties := schema["properties"].(map[string]any)
+
+	assert.Contains(t, properties, "rows_read")
+	assert.Contains(t, properties, "warnings")
+	assert.NotContains(t, schema["required"], "error") // omitempty
+}
+
+func TestValidateJSON(t *testing.T) {
+	valid := Record{
+		Nome:           "Tesouro IPCA+ 2035",
+		DataInicio:     "2024-12-22",
+		DataVencimento: "2035-05-15",
+		DataBase:       "2025-12-22",
+	}
+
+	tests := []struct {
+		name    string
+		value   any
+		json    string
+		wantErr string
+	}{
+		{name: "valid records", value: []Record{}, json: mustJSON(t, []Record{valid})},
+		{name: "empty array", value: []Record{}, json: `[]`},
+		{name: "null array", value: []Record{}, json: `null`, wantErr: "expected array"},
+		{name: "bad date", value: Record{}, json: `{"nome":"x","data_inicio":"22/12/2024","data_conversao":"","data_vencimento":"2035-05-15","data_base":"2025-12-22","taxa_compra_manha":0,"taxa_venda_manha":0,"pu_compra_manha":0,"pu_venda_manha":0,"pu_base_manha":0}`, wantErr: "$.data_inicio"},
+		{name: "wrong type", value: Record{}, json: `{"nome":"x","data_inicio":"2024-12-22","data_conversao":"","data_vencimento":"2035-05-15","data_base":"2025-12-22","taxa_compra_manha":"7,29","taxa_venda_manha":0,"pu_compra_manha":0,"pu_venda_manha":0,"pu_base_manha":0}`, wantErr: "expected number"},
+		{name: "missing property", value: Record{}, json: `{"nome":"x"}`, wantErr: "missing required property"},
+		{name: "unexpected property", value: runTimings{}, json: `{"download":1,"parse":1,"validate":1,"write":1,"total":1,"extra":1}`, wantErr: "unexpected property"},
+		{name: "integer", value: runTimings{}, json: `{"download":1.5,"parse":1,"validate":1,"write":1,"total":1}`, wantErr: "expected integer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decoded any
+			require.NoError(t, json.Unmarshal([]byte(tt.json), &decoded))
+			err := validateJSON(jsonSchema(tt.value, ""), decoded)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateJSONUsesCompiledPatterns(t *testing.T) {
+	// Only patterns compiled up front are accepted
+	schema := map[string]any{"type": "string", "pattern": `^x$`}
+	assert.ErrorContains(t, validateJSON(schema, "x"), "unsupported pattern")
+
+	schema["pattern"] = datePattern
+	assert.NoError(t, validateJSON(schema, "2025-12-22"))
+	assert.ErrorContains(t, validateJSON(schema, "22/12/2025"), "does not match pattern")
+}
+
+func TestWriteJSONRejectsInvalidOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latest.json")
+	records := []Record{{Nome: "Tesouro IPCA+ 2035", DataBase: "22/12/2025"}}
+
+	err := writeJSON(records, path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match schema")
+	assert.NoFileExists(t, path)
+	assert.NoFileExists(t, path+".tmp")
+}
+
+func TestWriteSchemas(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, writeSchemas(dir))
+
+	for _, s := range publishedSchemas {
+		data, err := os.ReadFile(filepath.Join(dir, s.name+".schema.json"))
+		require.NoError(t, err, s.name)
+
+		var schema map[string]any
+		require.NoError(t, json.Unmarshal(data, &schema))
+		assert.Equal(t, s.title, schema["title"])
+	}
+
+	// A published schema decoded from disk still validates records
+	data, err := os.ReadFile(filepath.Join(dir, "record.schema.json"))
+	require.NoError(t, err)
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal(data, &schema))
+
+	var record any
+	require.NoError(t, json.Unmarshal([]byte(mustJSON(t, Record{DataInicio: "2024-12-22", DataVencimento: "2035-05-15", DataBase: "2025-12-22"})), &record))
+	assert.NoError(t, validateJSON(schema, record))
+	delete(record.(map[string]any), "nome")
+	assert.Error(t, validateJSON(schema, record))
+}
+
+func mustJSON(t *testing.T, v any) string {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(data)
+}
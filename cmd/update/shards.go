@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+)
+
+// manifest indexes the per-bond and per-family shards, so clients can fetch a
+// single bond and skip downloads whose hash has not changed.
+type manifest struct {
+	SchemaVersion int              `json:"schema_version"`
+	MaxDataBase   string           `json:"max_data_base" schema:"date-or-empty"`
+	Bonds         []manifestBond   `json:"bonds"`
+	Familias      []manifestFamily `json:"familias"`
+}
+
+type manifestBond struct {
+	ID             string `json:"id"`
+	Nome           string `json:"nome"`
+	Familia        string `json:"familia"`
+	DataVencimento string `json:"data_vencimento" schema:"date"`
+	Path           string `json:"path"`   // Relative to the output directory
+	SHA256         string `json:"sha256"` // Hex SHA-256 of the file at path
+}
+
+type manifestFamily struct {
+	ID     string `json:"id"`
+	Nome   string `json:"nome"`
+	Bonds  int    `json:"bonds"`
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// writeShards writes bonds/<id>.json with one record each, familias/<id>.json
+// with the records of each family present, and manifest.json describing them.
+// Records must already be sorted.
+func writeShards(envelope latestEnvelope, outDir string) error {
+	records := envelope.Records
+	m := manifest{
+		SchemaVersion: envelope.SchemaVersion,
+		MaxDataBase:   envelope.MaxDataBase,
+		Bonds:         []manifestBond{},
+		Familias:      []manifestFamily{},
+	}
+
+	ids := bondSlugs(records)
+	bondsDir := filepath.Join(outDir, "bonds")
+	if err := os.MkdirAll(bondsDir, 0755); err != nil {
+		return err
+	}
+	for i, rec := range records {
+		sum, err := writeShard(rec, filepath.Join(bondsDir, ids[i]+".json"))
+		if err != nil {
+			return err
+		}
+		m.Bonds = append(m.Bonds, manifestBond{
+			ID:             ids[i],
+			Nome:           rec.Nome,
+			Familia:        bondFamily(rec.tipoTitulo).slug,
+			DataVencimento: rec.DataVencimento,
+			Path:           "bonds/" + ids[i] + ".json",
+			SHA256:         sum,
+		})
+	}
+
+	familiasDir := filepath.Join(outDir, "familias")
+	if err := os.MkdirAll(familiasDir, 0755); err != nil {
+		return err
+	}
+	for _, f := range families {
+		members := []Record{}
+		for _, rec := range records {
+			if bondFamily(rec.tipoTitulo).slug == f.slug {
+				members = append(members, rec)
+			}
+		}
+		if len(members) == 0 {
+			continue
+		}
+		sum, err := writeShard(members, filepath.Join(familiasDir, f.slug+".json"))
+		if err != nil {
+			return err
+		}
+		m.Familias = append(m.Familias, manifestFamily{
+			ID:     f.slug,
+			Nome:   f.name,
+			Bonds:  len(members),
+			Path:   "familias/" + f.slug + ".json",
+			SHA256: sum,
+		})
+	}
+
+	return writeJSON(m, filepath.Join(outDir, "manifest.json"))
+}
+
+// writeShard writes v as JSON to path and returns the hex SHA-256 of the file.
+func writeShard(v any, path string) (string, error) {
+	data, err := encodeJSON(v)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteShards(t *testing.T) {
+	records := []Record{
+		{Nome: "Tesouro IPCA+ 2035", DataInicio: "2024-12-22", DataVencimento: "2035-05-15", DataBase: "2025-12-22", TaxaCompraManha: 7.29, tipoTitulo: "Tesouro IPCA+"},
+		{Nome: "Tesouro IPCA+ com Juros Semestrais 2035", DataInicio: "2010-01-04", DataVencimento: "2035-05-15", DataBase: "2025-12-22", tipoTitulo: "Tesouro IPCA+ com Juros Semestrais"},
+		{Nome: "Tesouro Selic 2029", DataInicio: "2023-01-02", DataVencimento: "2029-03-01", DataBase: "2025-12-19", tipoTitulo: "Tesouro Selic"},
+	}
+	envelope := newLatestEnvelope(records, "https://example.com/data.csv", "abc123", time.Now())
+
+	dir := t.TempDir()
+	require.NoError(t, writeShards(envelope, dir))
+
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	require.NoError(t, err)
+	var m manifest
+	require.NoError(t, json.Unmarshal(data, &m))
+
+	assert.Equal(t, "2025-12-22", m.MaxDataBase)
+	require.Len(t, m.Bonds, 3)
+	assert.Equal(t, manifestBond{
+		ID:             "tesouro-ipca-2035",
+		Nome:           "Tesouro IPCA+ 2035",
+		Familia:        "ipca",
+		DataVencimento: "2035-05-15",
+		Path:           "bonds/tesouro-ipca-2035.json",
+		SHA256:         m.Bonds[0].SHA256,
+	}, m.Bonds[0])
+
+	// Family shards in family order, only for families present
+	require.Len(t, m.Familias, 2)
+	assert.Equal(t, "selic", m.Familias[0].ID)
+	assert.Equal(t, 1, m.Familias[0].Bonds)
+	assert.Equal(t, "ipca", m.Familias[1].ID)
+	assert.Equal(t, 2, m.Familias[1].Bonds)
+
+	// Every path exists and matches its hash
+	paths := []struct{ path, sum string }{}
+	for _, b := range m.Bonds {
+		paths = append(paths, struct{ path, sum string }{b.Path, b.SHA256})
+	}
+	for _, f := range m.Familias {
+		paths = append(paths, struct{ path, sum string }{f.Path, f.SHA256})
+	}
+	for _, p := range paths {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(p.path)))
+		require.NoError(t, err, p.path)
+		sum := sha256.Sum256(data)
+		assert.Equal(t, hex.EncodeToString(sum[:]), p.sum, p.path)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, "bonds", "tesouro-ipca-2035.json"))
+	require.NoError(t, err)
+	var bond Record
+	require.NoError(t, json.Unmarshal(data, &bond))
+	assert.InDelta(t, 7.29, bond.TaxaCompraManha, 0.0001)
+
+	data, err = os.ReadFile(filepath.Join(dir, "familias", "ipca.json"))
+	require.NoError(t, err)
+	var ipca []Record
+	require.NoError(t, json.Unmarshal(data, &ipca))
+	assert.Len(t, ipca, 2)
+}
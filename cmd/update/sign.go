@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	checksumsFile = "SHA256SUMS"
+	signatureFile = "SHA256SUMS.sig"
+
+	// signingKeyEnv holds the base64 signing key when --signing-key is not set
+	signingKeyEnv = "TESOURO_SIGNING_KEY"
+)
+
+// writeChecksums writes SHA256SUMS for every file under dir, in the format
+// read by `sha256sum -c`. When key is set, it also writes SHA256SUMS.sig, the
+// base64 ed25519 signature of SHA256SUMS.
+func writeChecksums(dir string, key ed25519.PrivateKey) error {
+	sums, err := checksumList(dir)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, checksumsFile), sums); err != nil {
+		return err
+	}
+	if key == nil {
+		return nil
+	}
+
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, sums))
+	return writeFileAtomic(filepath.Join(dir, signatureFile), []byte(sig+"\n"))
+}
+
+func checksumList(dir string) ([]byte, error) {
+	paths, err := listFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, path := range paths {
+		sum, err := fileSHA256(filepath.Join(dir, path))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "%s  %s\n", sum, path)
+	}
+	return buf.Bytes(), nil
+}
+
+// listFiles returns the slash-separated paths of the files under dir, sorted,
+// leaving out the checksum files themselves.
+func listFiles(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != checksumsFile && rel != signatureFile && !strings.HasSuffix(rel, ".tmp") {
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	sort.Strings(paths)
+	return paths, err
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyResult summarizes a successful verification.
+type verifyResult struct {
+	Verified int      // Listed files present and matching
+	Missing  int      // Listed files not present, e.g. in a partial download
+	Unlisted []string // Files present but not covered by SHA256SUMS
+}
+
+// verifyDir checks the signature of dir/SHA256SUMS against pub, then the hash
+// of every listed file present in dir. Listed files may be missing, so a
+// partial download can be verified, but at least one must be present.
+func verifyDir(dir string, pub ed25519.PublicKey) (verifyResult, error) {
+	var result verifyResult
+
+	sums, err := os.ReadFile(filepath.Join(dir, checksumsFile))
+	if err != nil {
+		return result, err
+	}
+	encoded, err := os.ReadFile(filepath.Join(dir, signatureFile))
+	if err != nil {
+		return result, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return result, fmt.Errorf("invalid %s: %w", signatureFile, err)
+	}
+	if !ed25519.Verify(pub, sums, sig) {
+		return result, fmt.Errorf("%s signature does not match the public key", checksumsFile)
+	}
+
+	listed := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for line := 1; scanner.Scan(); line++ {
+		want, path, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok || !fs.ValidPath(path) {
+			return result, fmt.Errorf("%s line %d: malformed entry", checksumsFile, line)
+		}
+		listed[path] = true
+
+		got, err := fileSHA256(filepath.Join(dir, filepath.FromSlash(path)))
+		if errors.Is(err, fs.ErrNotExist) {
+			result.Missing++
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		if got != want {
+			return result, fmt.Errorf("%s: checksum mismatch", path)
+		}
+		result.Verified++
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+	if result.Verified == 0 {
+		return result, fmt.Errorf("none of the files listed in %s were found", checksumsFile)
+	}
+
+	paths, err := listFiles(dir)
+	if err != nil {
+		return result, err
+	}
+	for _, path := range paths {
+		if !listed[path] {
+			result.Unlisted = append(result.Unlisted, path)
+		}
+	}
+	return result, nil
+}
+
+// loadSigningKey reads a base64 ed25519 key, either the 32-byte seed or the
+// 64-byte private key, from path, or from $TESOURO_SIGNING_KEY when path is
+// empty. A 64-byte key must hold the public key of its own seed. It returns
+// nil when neither is set.
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	encoded := os.Getenv(signingKeyEnv)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(data)
+	}
+	if strings.TrimSpace(encoded) == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %w", err)
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		// The second half is the public key; a mismatched one would publish
+		// signatures that no published public key verifies
+		derived := ed25519.NewKeyFromSeed(key[:ed25519.SeedSize])
+		if !bytes.Equal(derived, key) {
+			return nil, fmt.Errorf("invalid signing key: public half does not match the seed")
+		}
+		return derived, nil
+	}
+	return nil, fmt.Errorf("invalid signing key: expected %d or %d bytes, got %d", ed25519.SeedSize, ed25519.PrivateKeySize, len(key))
+}
+
+// parsePublicKey decodes a base64 ed25519 public key, given either directly
+// or as the path of a file holding it.
+func parsePublicKey(s string) (ed25519.PublicKey, error) {
+	if data, err := os.ReadFile(s); err == nil {
+		s = string(data)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key: expected %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// verifyCommand implements `update verify`.
+func verifyCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	dir := flags.String("dir", defaultOutDir, "Directory holding SHA256SUMS, SHA256SUMS.sig and the files to check")
+	publicKey := flags.String("public-key", "", "Base64 ed25519 public key, or a file holding it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *publicKey == "" {
+		return fmt.Errorf("--public-key is required")
+	}
+
+	pub, err := parsePublicKey(*publicKey)
+	if err != nil {
+		return err
+	}
+	result, err := verifyDir(*dir, pub)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range result.Unlisted {
+		fmt.Fprintf(out, "Not covered by %s: %s\n", checksumsFile, path)
+	}
+	fmt.Fprintf(out, "OK: %d files verified", result.Verified)
+	if result.Missing > 0 {
+		fmt.Fprintf(out, " (%d listed files not present)", result.Missing)
+	}
+	fmt.Fprintln(out)
+	return nil
+}
+
+// keygenCommand implements `update keygen`, printing a new key pair.
+func keygenCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Signing key (secret, for %s or --signing-key): %s\n", signingKeyEnv, base64.StdEncoding.EncodeToString(priv.Seed()))
+	fmt.Fprintf(out, "Public key (for verify --public-key): %s\n", base64.StdEncoding.EncodeToString(pub))
+	return nil
+}
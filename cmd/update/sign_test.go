@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksumsAndVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	newDir := func(t *testing.T) string {
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "v2"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "latest.json"), []byte(`[{"nome":"Tesouro IPCA+ 2035"}]`), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "v2", "latest.json"), []byte(`{"records":[]}`), 0644))
+		require.NoError(t, writeChecksums(dir, priv))
+		return dir
+	}
+
+	t.Run("format", func(t *testing.T) {
+		dir := newDir(t)
+		sums, err := os.ReadFile(filepath.Join(dir, checksumsFile))
+		require.NoError(t, err)
+
+		sum := sha256.Sum256([]byte(`[{"nome":"Tesouro IPCA+ 2035"}]`))
+		lines := strings.Split(strings.TrimSpace(string(sums)), "\n")
+		require.Len(t, lines, 2)
+		assert.Equal(t, hex.EncodeToString(sum[:])+"  latest.json", lines[0])
+		assert.True(t, strings.HasSuffix(lines[1], "  v2/latest.json"))
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		result, err := verifyDir(newDir(t), pub)
+		require.NoError(t, err)
+		assert.Equal(t, 2, result.Verified)
+		assert.Zero(t, result.Missing)
+		assert.Empty(t, result.Unlisted)
+	})
+
+	t.Run("partial download", func(t *testing.T) {
+		dir := newDir(t)
+		require.NoError(t, os.RemoveAll(filepath.Join(dir, "v2")))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("mine"), 0644))
+
+		result, err := verifyDir(dir, pub)
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Verified)
+		assert.Equal(t, 1, result.Missing)
+		assert.Equal(t, []string{"notes.txt"}, result.Unlisted)
+	})
+
+	t.Run("edited file", func(t *testing.T) {
+		dir := newDir(t)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "latest.json"), []byte(`[{"nome":"edited"}]`), 0644))
+
+		_, err := verifyDir(dir, pub)
+		assert.ErrorContains(t, err, "latest.json: checksum mismatch")
+	})
+
+	t.Run("edited checksums", func(t *testing.T) {
+		dir := newDir(t)
+		path := filepath.Join(dir, checksumsFile)
+		sums, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, bytes.Replace(sums, []byte("v2/"), []byte("v3/"), 1), 0644))
+
+		_, err = verifyDir(dir, pub)
+		assert.ErrorContains(t, err, "signature does not match")
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		other, _, err := ed25519.GenerateKey(nil)
+		require.NoError(t, err)
+
+		_, err = verifyDir(newDir(t), other)
+		assert.ErrorContains(t, err, "signature does not match")
+	})
+
+	t.Run("command", func(t *testing.T) {
+		var out bytes.Buffer
+		err := verifyCommand([]string{"--dir", newDir(t), "--public-key", base64.StdEncoding.EncodeToString(pub)}, &out)
+		require.NoError(t, err)
+		assert.Equal(t, "OK: 2 files verified\n", out.String())
+	})
+}
+
+func TestWriteChecksumsUnsigned(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "latest.json"), []byte("[]"), 0644))
+	require.NoError(t, writeChecksums(dir, nil))
+
+	assert.FileExists(t, filepath.Join(dir, checksumsFile))
+	assert.NoFileExists(t, filepath.Join(dir, signatureFile))
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	seed := base64.StdEncoding.EncodeToString(priv.Seed())
+
+	t.Setenv(signingKeyEnv, "")
+	key, err := loadSigningKey("")
+	require.NoError(t, err)
+	assert.Nil(t, key)
+
+	t.Setenv(signingKeyEnv, seed)
+	key, err = loadSigningKey("")
+	require.NoError(t, err)
+	assert.Equal(t, priv, key)
+
+	// The flag takes precedence over the environment
+	path := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(priv)+"\n"), 0600))
+	t.Setenv(signingKeyEnv, "not base64")
+	key, err = loadSigningKey(path)
+	require.NoError(t, err)
+	assert.Equal(t, priv, key)
+
+	t.Setenv(signingKeyEnv, base64.StdEncoding.EncodeToString([]byte("short")))
+	_, err = loadSigningKey("")
+	assert.Error(t, err)
+
+	// A 64-byte key whose public half belongs to another seed is refused
+	other, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	mismatched := append(append([]byte{}, priv.Seed()...), other...)
+	t.Setenv(signingKeyEnv, base64.StdEncoding.EncodeToString(mismatched))
+	_, err = loadSigningKey("")
+	assert.ErrorContains(t, err, "does not match the seed")
+}
@@ -0,0 +1,43 @@
+package main
+
+import "strings"
+
+// slugify lowercases s and replaces every run of characters other than ASCII
+// letters and digits with a single hyphen: "Tesouro IPCA+ 2035" becomes
+// "tesouro-ipca-2035".
+func slugify(s string) string {
+	var sb strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if hyphen && sb.Len() > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	return sb.String()
+}
+
+// bondSlugs returns a unique id for every record, in the same order. The id
+// is the slugified nome, with the maturity date appended when several records
+// share a nome.
+func bondSlugs(records []Record) []string {
+	count := map[string]int{}
+	for _, rec := range records {
+		count[slugify(rec.Nome)]++
+	}
+
+	slugs := make([]string, len(records))
+	for i, rec := range records {
+		slug := slugify(rec.Nome)
+		if count[slug] > 1 {
+			slug += "-" + rec.DataVencimento
+		}
+		slugs[i] = slug
+	}
+	return slugs
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Tesouro IPCA+ 2035", "tesouro-ipca-2035"},
+		{"Tesouro IPCA+ com Juros Semestrais 2035", "tesouro-ipca-com-juros-semestrais-2035"},
+		{"Tesouro Renda+ Aposentadoria Extra 2049", "tesouro-renda-aposentadoria-extra-2049"},
+		{"  Tesouro  Selic++ ", "tesouro-selic"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, slugify(tt.input))
+		})
+	}
+}
+
+func TestBondSlugs(t *testing.T) {
+	records := []Record{
+		{Nome: "Tesouro IPCA+ 2035", DataVencimento: "2035-05-15"},
+		{Nome: "Tesouro Prefixado 2008", DataVencimento: "2008-01-01"},
+		{Nome: "Tesouro Prefixado 2008", DataVencimento: "2008-04-01"},
+	}
+
+	assert.Equal(t, []string{
+		"tesouro-ipca-2035",
+		"tesouro-prefixado-2008-2008-01-01",
+		"tesouro-prefixado-2008-2008-04-01",
+	}, bondSlugs(records))
+}
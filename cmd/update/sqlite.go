@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE bonds (
+	id              TEXT PRIMARY KEY,
+	tipo            TEXT NOT NULL,
+	nome            TEXT NOT NULL,
+	data_vencimento TEXT NOT NULL,
+	data_conversao  TEXT,
+	classificacao   TEXT NOT NULL,
+	UNIQUE (tipo, data_vencimento)
+);
+
+CREATE TABLE prices (
+	bond_id           TEXT NOT NULL REFERENCES bonds (id),
+	data_base         TEXT NOT NULL,
+	taxa_compra_manha REAL NOT NULL,
+	taxa_venda_manha  REAL NOT NULL,
+	pu_compra_manha   REAL NOT NULL,
+	pu_venda_manha    REAL NOT NULL,
+	pu_base_manha     REAL NOT NULL,
+	PRIMARY KEY (bond_id, data_base)
+) WITHOUT ROWID;
+
+CREATE INDEX bonds_nome ON bonds (nome);
+CREATE INDEX prices_data_base ON prices (data_base, bond_id);
+`
+
+// writeSQLite writes the full price history to a SQLite database with one row
+// per bond and one row per bond and Data Base. Bond ids are derived from the
+// bond's type and maturity, so they never change between downloads.
+func writeSQLite(latest map[string]*assetRecord, path string) error {
+	tmpPath := path + ".tmp"
+	os.Remove(tmpPath)
+
+	if err := fillSQLite(sortedAssets(latest), tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
+
+func fillSQLite(assets []*assetRecord, path string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// The file is built from scratch and renamed into place, so no journal is needed
+	if _, err := db.Exec("PRAGMA journal_mode = OFF; PRAGMA synchronous = OFF;"); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(sqliteSchema); err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	bondStmt, err := tx.Prepare("INSERT INTO bonds (id, tipo, nome, data_vencimento, data_conversao, classificacao) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer bondStmt.Close()
+
+	// The parser already resolved rows sharing a Data Base (--duplicates), so
+	// a primary key clash here is a bug and fails the write
+	priceStmt, err := tx.Prepare("INSERT INTO prices (bond_id, data_base, taxa_compra_manha, taxa_venda_manha, pu_compra_manha, pu_venda_manha, pu_base_manha) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer priceStmt.Close()
+
+	for _, asset := range assets {
+		rec := asset.record
+		id := sqliteBondID(rec)
+
+		var conversao any
+		if rec.DataConversao != "" {
+			conversao = rec.DataConversao
+		}
+		if _, err := bondStmt.Exec(id, rec.tipoTitulo, rec.Nome, rec.DataVencimento, conversao, bondFamily(rec.tipoTitulo).name); err != nil {
+			return fmt.Errorf("failed to insert bond %s (%s): %w", rec.Nome, id, err)
+		}
+
+		for _, row := range sortedHistory(asset.history) {
+			if _, err := priceStmt.Exec(id, row.DataBase, row.TaxaCompraManha, row.TaxaVendaManha, row.PUCompraManha, row.PUVendaManha, row.PUBaseManha); err != nil {
+				return fmt.Errorf("failed to insert price for %s on %s: %w", rec.Nome, row.DataBase, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return db.Close()
+}
+
+// sqliteBondID identifies a bond by its type and maturity, the key of the
+// upstream file, e.g. tesouro-ipca-2035-05-15.
+func sqliteBondID(rec Record) string {
+	return slugify(rec.tipoTitulo + " " + rec.DataVencimento)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSQLite(t *testing.T) {
+	csv := csvHeader +
+		"Tesouro IPCA+;15/05/2035;22/12/2025;7,31;7,43;2376,00;2350,00;2350,00\n" +
+		"Tesouro IPCA+;15/05/2035;19/12/2025;7,29;7,41;2374,37;2348,76;2348,76\n" +
+		"Tesouro Renda+ Aposentadoria Extra;15/12/2049;22/12/2025;6,80;6,92;1500,00;1490,00;1490,00\n" +
+		"Tesouro Selic;01/03/2029;22/12/2025;0,10;0,12;17000,00;16990,00;16990,00\n"
+	latest, err := parseCSV(strings.NewReader(csv))
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "tesouro.sqlite")
+	require.NoError(t, writeSQLite(latest, path))
+	assert.NoFileExists(t, path+".tmp")
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var bonds int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM bonds").Scan(&bonds))
+	assert.Equal(t, 3, bonds)
+
+	// Bond ids come from the type and maturity
+	var id string
+	var tipo, classificacao string
+	var conversao sql.NullString
+	require.NoError(t, db.QueryRow("SELECT id, tipo, data_conversao, classificacao FROM bonds WHERE nome = ?", "Tesouro Renda+ Aposentadoria Extra 2030").Scan(&id, &tipo, &conversao, &classificacao))
+	assert.Equal(t, "tesouro-renda-aposentadoria-extra-2049-12-15", id)
+	assert.Equal(t, "Tesouro Renda+ Aposentadoria Extra", tipo)
+	assert.Equal(t, "2030-01-15", conversao.String)
+	assert.Equal(t, "Renda+", classificacao)
+
+	require.NoError(t, db.QueryRow("SELECT data_conversao FROM bonds WHERE nome = ?", "Tesouro Selic 2029").Scan(&conversao))
+	assert.False(t, conversao.Valid)
+
+	rows, err := db.Query(`
+		SELECT p.data_base, p.taxa_compra_manha
+		FROM prices p JOIN bonds b ON b.id = p.bond_id
+		WHERE b.nome = ? ORDER BY p.data_base`, "Tesouro IPCA+ 2035")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var dates []string
+	var rates []float64
+	for rows.Next() {
+		var date string
+		var rate float64
+		require.NoError(t, rows.Scan(&date, &rate))
+		dates = append(dates, date)
+		rates = append(rates, rate)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"2025-12-19", "2025-12-22"}, dates)
+	assert.InDeltaSlice(t, []float64{7.29, 7.31}, rates, 0.0001)
+}
+
+func TestWriteSQLiteRejectsRepeatedDataBase(t *testing.T) {
+	csv := csvHeader +
+		"Tesouro Selic;01/03/2029;22/12/2025;0,10;0,12;17000,00;16990,00;16990,00\n"
+	latest, err := parseCSV(strings.NewReader(csv))
+	require.NoError(t, err)
+
+	// A row the parser failed to resolve must not silently replace another
+	for _, asset := range latest {
+		asset.history = append(asset.history, asset.history[0])
+	}
+	err = writeSQLite(latest, filepath.Join(t.TempDir(), "tesouro.sqlite"))
+	assert.ErrorContains(t, err, "failed to insert price for Tesouro Selic 2029 on 2025-12-22")
+}
+
+func TestSQLiteBondIDsAreStable(t *testing.T) {
+	csv := csvHeader +
+		"Tesouro Selic;01/03/2029;22/12/2025;0,10;0,12;17000,00;16990,00;16990,00\n"
+	ids := func(csv string) map[string]string {
+		latest, err := parseCSV(strings.NewReader(csv))
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "tesouro.sqlite")
+		require.NoError(t, writeSQLite(latest, path))
+
+		db, err := sql.Open("sqlite", path)
+		require.NoError(t, err)
+		defer db.Close()
+		rows, err := db.Query("SELECT nome, id FROM bonds")
+		require.NoError(t, err)
+		defer rows.Close()
+		ids := map[string]string{}
+		for rows.Next() {
+			var nome, id string
+			require.NoError(t, rows.Scan(&nome, &id))
+			ids[nome] = id
+		}
+		require.NoError(t, rows.Err())
+		return ids
+	}
+
+	before := ids(csv)
+	// A new bond sorting first leaves existing ids alone
+	after := ids(csv + "Tesouro Educa+;15/12/2030;22/12/2025;6,80;6,92;1500,00;1490,00;1490,00\n")
+	assert.Equal(t, "tesouro-selic-2029-03-01", before["Tesouro Selic 2029"])
+	assert.Equal(t, before["Tesouro Selic 2029"], after["Tesouro Selic 2029"])
+	assert.Len(t, after, 2)
+}
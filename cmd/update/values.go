@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// valueFields are the fields TESOURODIRETO() accepts in GOOGLE_SHEETS_FUNCTION.gs.
+var valueFields = []string{
+	"data_vencimento", "data_base", "data_inicio", "data_conversao",
+	"taxa_compra_manha", "taxa_venda_manha",
+	"pu_compra_manha", "pu_venda_manha", "pu_base_manha",
+}
+
+// writeValues writes one tiny file per bond and field, dir/<id>/<field>.txt,
+// holding only the raw value, so =IMPORTDATA() can read a single value
+// without Apps Script. Dates are ISO and numbers use a dot decimal separator.
+func writeValues(records []Record, dir string) error {
+	ids := bondSlugs(records)
+	for i, rec := range records {
+		bondDir := filepath.Join(dir, ids[i])
+		if err := os.MkdirAll(bondDir, 0755); err != nil {
+			return err
+		}
+		for _, field := range valueFields {
+			if err := os.WriteFile(filepath.Join(bondDir, field+".txt"), []byte(fieldValue(rec, field)), 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fieldValue returns the raw value of a record field, keyed by JSON name.
+func fieldValue(rec Record, field string) string {
+	for _, col := range csvColumns {
+		if col.key != field {
+			continue
+		}
+		if col.kind == columnNumber {
+			return formatFloat(col.num(rec))
+		}
+		return col.text(rec)
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteValues(t *testing.T) {
+	records := []Record{
+		{Nome: "Tesouro IPCA+ 2035", DataInicio: "2024-12-22", DataVencimento: "2035-05-15", DataBase: "2025-12-22", TaxaCompraManha: 7.29, PUBaseManha: 2348.76},
+		{Nome: "Tesouro Educa+ 2030", DataInicio: "2023-08-01", DataConversao: "2030-01-15", DataVencimento: "2034-12-15", DataBase: "2025-12-22"},
+	}
+
+	dir := filepath.Join(t.TempDir(), "v")
+	require.NoError(t, writeValues(records, dir))
+
+	read := func(parts ...string) string {
+		data, err := os.ReadFile(filepath.Join(append([]string{dir}, parts...)...))
+		require.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "7.29", read("tesouro-ipca-2035", "taxa_compra_manha.txt"))
+	assert.Equal(t, "2348.76", read("tesouro-ipca-2035", "pu_base_manha.txt"))
+	assert.Equal(t, "2035-05-15", read("tesouro-ipca-2035", "data_vencimento.txt"))
+	assert.Equal(t, "0", read("tesouro-ipca-2035", "taxa_venda_manha.txt"))
+	assert.Equal(t, "", read("tesouro-ipca-2035", "data_conversao.txt"))
+	assert.Equal(t, "2030-01-15", read("tesouro-educa-2030", "data_conversao.txt"))
+
+	entries, err := os.ReadDir(filepath.Join(dir, "tesouro-ipca-2035"))
+	require.NoError(t, err)
+	assert.Len(t, entries, len(valueFields))
+}
+
+func TestFieldValue(t *testing.T) {
+	rec := Record{Nome: "Tesouro Selic 2029", DataBase: "2025-12-22", PUCompraManha: 17000.5}
+	assert.Equal(t, "2025-12-22", fieldValue(rec, "data_base"))
+	assert.Equal(t, "17000.5", fieldValue(rec, "pu_compra_manha"))
+	assert.Equal(t, "", fieldValue(rec, "unknown"))
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func sortRecords(records []Record) {
@@ -18,22 +22,43 @@ func sortRecords(records []Record) {
 	})
 }
 
-func writeJSON(records []Record, path string) error {
-	tmpPath := path + ".tmp"
-	file, err := os.Create(tmpPath)
-	if err != nil {
-		return err
+// sortedAssets returns the assets in the same order sortRecords uses for records.
+func sortedAssets(latest map[string]*assetRecord) []*assetRecord {
+	assets := make([]*assetRecord, 0, len(latest))
+	for _, asset := range latest {
+		assets = append(assets, asset)
 	}
-	defer file.Close()
+	sort.Slice(assets, func(i, j int) bool {
+		a, b := assets[i].record, assets[j].record
+		if a.Nome != b.Nome {
+			return a.Nome < b.Nome
+		}
+		return a.DataVencimento < b.DataVencimento
+	})
+	return assets
+}
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(records); err != nil {
-		os.Remove(tmpPath)
-		return err
+func newLatestEnvelope(records []Record, sourceURL, sourceSHA256 string, generatedAt time.Time) latestEnvelope {
+	maxDataBase := ""
+	for _, rec := range records {
+		if rec.DataBase > maxDataBase {
+			maxDataBase = rec.DataBase
+		}
 	}
+	return latestEnvelope{
+		SchemaVersion: schemaVersion,
+		GeneratedAt:   generatedAt.UTC().Format(time.RFC3339),
+		SourceURL:     sourceURL,
+		SourceSHA256:  sourceSHA256,
+		MaxDataBase:   maxDataBase,
+		Records:       records,
+	}
+}
 
-	if err := file.Close(); err != nil {
+// writeFileAtomic writes data to a temp file next to path and renames it into place.
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
 		os.Remove(tmpPath)
 		return err
 	}
@@ -46,7 +71,56 @@ func writeJSON(records []Record, path string) error {
 	return nil
 }
 
+// writeJSON encodes v as indented JSON and validates it against the schema
+// generated from its Go type before atomically replacing path.
+func writeJSON(v any, path string) error {
+	data, err := encodeJSON(v)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// encodeJSON encodes v as indented JSON and validates the result against the
+// schema generated from its Go type, so nothing off-contract is published.
+func encodeJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+
+	var decoded any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		return nil, err
+	}
+	if err := validateJSON(jsonSchema(v, ""), decoded); err != nil {
+		return nil, fmt.Errorf("output does not match schema: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeSchemas publishes a JSON Schema document for every JSON output in dir.
+func writeSchemas(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, s := range publishedSchemas {
+		if err := writeJSON(jsonSchema(s.value, s.title), filepath.Join(dir, s.name+".schema.json")); err != nil {
+			return fmt.Errorf("%s: %w", s.name, err)
+		}
+	}
+	return nil
+}
+
+// writeCSV writes the PT-BR dialect: semicolon-delimited with comma decimals.
 func writeCSV(records []Record, path string) error {
+	return writeCSVDialect(records, path, dialectPTBR)
+}
+
+func writeCSVDialect(records []Record, path string, dialect csvDialect) error {
 	tmpPath := path + ".tmp"
 	file, err := os.Create(tmpPath)
 	if err != nil {
@@ -55,30 +129,17 @@ func writeCSV(records []Record, path string) error {
 	defer file.Close()
 
 	writer := csv.NewWriter(file)
-	writer.Comma = ';'
+	writer.Comma = dialect.comma
 
 	// Write header
-	header := []string{"Nome", "Data Inicio", "Data Conversao", "Data Vencimento", "Data Base", "Taxa Compra Manha", "Taxa Venda Manha", "PU Compra Manha", "PU Venda Manha", "PU Base Manha"}
-	if err := writer.Write(header); err != nil {
+	if err := writer.Write(dialect.header()); err != nil {
 		os.Remove(tmpPath)
 		return err
 	}
 
 	// Write records
 	for _, rec := range records {
-		row := []string{
-			rec.Nome,
-			rec.DataInicio,
-			rec.DataConversao,
-			rec.DataVencimento,
-			rec.DataBase,
-			formatFloatBR(rec.TaxaCompraManha),
-			formatFloatBR(rec.TaxaVendaManha),
-			formatFloatBR(rec.PUCompraManha),
-			formatFloatBR(rec.PUVendaManha),
-			formatFloatBR(rec.PUBaseManha),
-		}
-		if err := writer.Write(row); err != nil {
+		if err := writer.Write(dialect.row(rec)); err != nil {
 			os.Remove(tmpPath)
 			return err
 		}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cell styles, as indexes into cellXfs in xlsxStyles
+const (
+	xlsxStyleDefault = 0
+	xlsxStyleHeader  = 1
+	xlsxStyleDate    = 2
+	xlsxStyleRate    = 3
+	xlsxStylePU      = 4
+)
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/><numFmt numFmtId="165" formatCode="0.00##"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="5">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+</cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>`
+
+// xlsxColumns matches the CSV header, with a style and width per column.
+var xlsxColumns = []struct {
+	header string
+	style  int
+	width  int
+}{
+	{"Nome", xlsxStyleDefault, 42},
+	{"Data Inicio", xlsxStyleDate, 12},
+	{"Data Conversao", xlsxStyleDate, 15},
+	{"Data Vencimento", xlsxStyleDate, 16},
+	{"Data Base", xlsxStyleDate, 12},
+	{"Taxa Compra Manha", xlsxStyleRate, 18},
+	{"Taxa Venda Manha", xlsxStyleRate, 17},
+	{"PU Compra Manha", xlsxStylePU, 16},
+	{"PU Venda Manha", xlsxStylePU, 15},
+	{"PU Base Manha", xlsxStylePU, 14},
+}
+
+// excelEpoch is day zero of Excel's 1900 date system, accounting for its
+// fictitious 1900-02-29.
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+type xlsxSheet struct {
+	name    string
+	records []Record
+}
+
+// writeXLSX writes an Excel workbook with a "Latest" sheet holding every
+// record and one sheet per bond family. Records must already be sorted.
+func writeXLSX(records []Record, path string) error {
+	sheets := []xlsxSheet{{name: "Latest", records: records}}
+	for _, f := range families {
+		var members []Record
+		for _, rec := range records {
+			if bondFamily(rec.tipoTitulo).slug == f.slug {
+				members = append(members, rec)
+			}
+		}
+		if len(members) > 0 {
+			sheets = append(sheets, xlsxSheet{name: f.name, records: members})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := encodeXLSX(&buf, sheets); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+func encodeXLSX(buf *bytes.Buffer, sheets []xlsxSheet) error {
+	// Zip entries carry no timestamps, so identical records give identical files
+	zw := zip.NewWriter(buf)
+
+	var contentTypes, workbookSheets, workbookRels strings.Builder
+	for i := range sheets {
+		n := i + 1
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&workbookSheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sheets[i].name), n, n)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+	fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(sheets)+1)
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			contentTypes.String() + `</Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + workbookSheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			workbookRels.String() + `</Relationships>`},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for i, sheet := range sheets {
+		parts = append(parts, struct {
+			name    string
+			content string
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), xlsxWorksheet(sheet.records)})
+	}
+
+	for _, part := range parts {
+		w, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// xlsxWorksheet renders one sheet with a frozen, auto-filtered header row.
+func xlsxWorksheet(records []Record) string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	sb.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+
+	sb.WriteString(`<cols>`)
+	for i, col := range xlsxColumns {
+		fmt.Fprintf(&sb, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, col.width)
+	}
+	sb.WriteString(`</cols><sheetData>`)
+
+	sb.WriteString(`<row r="1">`)
+	for i, col := range xlsxColumns {
+		xlsxStringCell(&sb, i, 1, col.header, xlsxStyleHeader)
+	}
+	sb.WriteString(`</row>`)
+
+	for i, rec := range records {
+		r := i + 2
+		fmt.Fprintf(&sb, `<row r="%d">`, r)
+		xlsxStringCell(&sb, 0, r, rec.Nome, xlsxStyleDefault)
+		for c, date := range []string{rec.DataInicio, rec.DataConversao, rec.DataVencimento, rec.DataBase} {
+			xlsxDateCell(&sb, c+1, r, date)
+		}
+		for c, v := range []float64{rec.TaxaCompraManha, rec.TaxaVendaManha, rec.PUCompraManha, rec.PUVendaManha, rec.PUBaseManha} {
+			xlsxNumberCell(&sb, c+5, r, v, xlsxColumns[c+5].style)
+		}
+		sb.WriteString(`</row>`)
+	}
+
+	sb.WriteString(`</sheetData>`)
+	fmt.Fprintf(&sb, `<autoFilter ref="A1:%s%d"/>`, xlsxColumnName(len(xlsxColumns)-1), len(records)+1)
+	sb.WriteString(`</worksheet>`)
+	return sb.String()
+}
+
+func xlsxStringCell(sb *strings.Builder, col, row int, s string, style int) {
+	fmt.Fprintf(sb, `<c r="%s%d" s="%d" t="inlineStr"><is><t>%s</t></is></c>`, xlsxColumnName(col), row, style, xmlEscape(s))
+}
+
+func xlsxNumberCell(sb *strings.Builder, col, row int, v float64, style int) {
+	fmt.Fprintf(sb, `<c r="%s%d" s="%d"><v>%s</v></c>`, xlsxColumnName(col), row, style, strconv.FormatFloat(v, 'f', -1, 64))
+}
+
+// xlsxDateCell writes an ISO date as an Excel date serial. Empty and invalid
+// dates leave the cell blank.
+func xlsxDateCell(sb *strings.Builder, col, row int, date string) {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return
+	}
+	serial := int(t.Sub(excelEpoch).Hours() / 24)
+	fmt.Fprintf(sb, `<c r="%s%d" s="%d"><v>%d</v></c>`, xlsxColumnName(col), row, xlsxStyleDate, serial)
+}
+
+// xlsxColumnName converts a zero-based column index to its letter name (0 -> A).
+func xlsxColumnName(col int) string {
+	name := ""
+	for col >= 0 {
+		name = string(rune('A'+col%26)) + name
+		col = col/26 - 1
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
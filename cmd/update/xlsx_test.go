@@ -0,0 +1,87 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteXLSX(t *testing.T) {
+	records := []Record{
+		{Nome: "Tesouro Educa+ 2030", DataInicio: "2023-08-01", DataConversao: "2030-01-15", DataVencimento: "2034-12-15", DataBase: "2025-12-22", TaxaCompraManha: 5.36, PUCompraManha: 2587.63, tipoTitulo: "Tesouro Educa+"},
+		{Nome: "Tesouro IPCA+ 2035", DataInicio: "2024-12-22", DataVencimento: "2035-05-15", DataBase: "2025-12-22", TaxaCompraManha: 7.29, PUCompraManha: 2374.37, tipoTitulo: "Tesouro IPCA+"},
+		{Nome: "Tesouro IPCA+ com Juros Semestrais 2035", DataInicio: "2010-01-04", DataVencimento: "2035-05-15", DataBase: "2025-12-22", TaxaCompraManha: 7.1, tipoTitulo: "Tesouro IPCA+ com Juros Semestrais"},
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tesouro.xlsx")
+	require.NoError(t, writeXLSX(records, path))
+	assert.NoFileExists(t, path+".tmp")
+
+	parts := readZip(t, path)
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml"} {
+		assert.Contains(t, parts, name)
+	}
+
+	// Latest plus one sheet per family present, in family order
+	workbook := parts["xl/workbook.xml"]
+	assert.Contains(t, workbook, `<sheet name="Latest" sheetId="1" r:id="rId1"/>`)
+	assert.Contains(t, workbook, `<sheet name="IPCA+" sheetId="2" r:id="rId2"/>`)
+	assert.Contains(t, workbook, `<sheet name="Educa+" sheetId="3" r:id="rId3"/>`)
+	assert.NotContains(t, workbook, "Selic")
+
+	latest := parts["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, latest, `state="frozen"`)
+	assert.Contains(t, latest, `<autoFilter ref="A1:J4"/>`)
+	assert.Contains(t, latest, `<c r="A1" s="1" t="inlineStr"><is><t>Nome</t></is></c>`)
+	// 2035-05-15 is Excel serial 49444
+	assert.Contains(t, latest, `<c r="D3" s="2"><v>49444</v></c>`)
+	assert.Contains(t, latest, `<c r="F3" s="3"><v>7.29</v></c>`)
+	assert.Contains(t, latest, `<c r="H3" s="4"><v>2374.37</v></c>`)
+	// No conversion date for IPCA+
+	assert.NotContains(t, latest, `r="C3"`)
+
+	ipca := parts["xl/worksheets/sheet2.xml"]
+	assert.Equal(t, 3, strings.Count(ipca, "<row "))
+
+	// Identical records give a byte-identical workbook
+	first, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, writeXLSX(records, path))
+	second, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(first, second))
+}
+
+func TestXLSXColumnName(t *testing.T) {
+	assert.Equal(t, "A", xlsxColumnName(0))
+	assert.Equal(t, "J", xlsxColumnName(9))
+	assert.Equal(t, "Z", xlsxColumnName(25))
+	assert.Equal(t, "AA", xlsxColumnName(26))
+	assert.Equal(t, "AZ", xlsxColumnName(51))
+	assert.Equal(t, "BA", xlsxColumnName(52))
+}
+
+func readZip(t *testing.T, path string) map[string]string {
+	zr, err := zip.OpenReader(path)
+	require.NoError(t, err)
+	defer zr.Close()
+
+	parts := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		parts[f.Name] = string(data)
+	}
+	return parts
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// xmlDocument is the layout of latest.xml, designed for Excel's
+// =FILTERXML(WEBSERVICE(url), xpath).
+type xmlDocument struct {
+	XMLName  xml.Name    `xml:"tesouro"`
+	Metadata xmlMetadata `xml:"metadata"`
+	Titulos  []xmlTitulo `xml:"titulos>titulo"`
+}
+
+type xmlMetadata struct {
+	SchemaVersion      int        `xml:"schema_version"`
+	GeneratedAt        string     `xml:"generated_at"`
+	SourceURL          string     `xml:"source_url"`
+	SourceSHA256       string     `xml:"source_sha256"`
+	SourceLastModified string     `xml:"source_last_modified,omitempty"`
+	MaxDataBase        string     `xml:"max_data_base"`
+	XPaths             []xmlXPath `xml:"xpaths>xpath"`
+}
+
+type xmlXPath struct {
+	Description string `xml:"description,attr"`
+	Expr        string `xml:",chardata"`
+}
+
+// xmlTitulo holds numbers as strings so they are never written in exponent
+// notation, which FILTERXML would not read as a number.
+type xmlTitulo struct {
+	XMLName         xml.Name `xml:"titulo"`
+	ID              string   `xml:"id"`
+	Nome            string   `xml:"nome"`
+	DataInicio      string   `xml:"data_inicio"`
+	DataConversao   string   `xml:"data_conversao"`
+	DataVencimento  string   `xml:"data_vencimento"`
+	DataBase        string   `xml:"data_base"`
+	TaxaCompraManha string   `xml:"taxa_compra_manha"`
+	TaxaVendaManha  string   `xml:"taxa_venda_manha"`
+	PUCompraManha   string   `xml:"pu_compra_manha"`
+	PUVendaManha    string   `xml:"pu_venda_manha"`
+	PUBaseManha     string   `xml:"pu_base_manha"`
+}
+
+// xmlXPaths documents the lookups supported by latest.xml and the per-bond files.
+var xmlXPaths = []xmlXPath{
+	{"Field of a bond by nome (latest.xml)", "//titulo[nome='Tesouro IPCA+ 2035']/taxa_compra_manha"},
+	{"Field of a bond by id (latest.xml)", "//titulo[id='tesouro-ipca-2035']/pu_venda_manha"},
+	{"Field of a bond by nome and maturity (latest.xml)", "//titulo[nome='Tesouro IPCA+ 2035' and data_vencimento='2035-05-15']/taxa_venda_manha"},
+	{"Every bond name (latest.xml)", "//titulo/nome"},
+	{"Latest Data Base (latest.xml)", "//metadata/max_data_base"},
+	{"Field of a single bond (xml/<id>.xml)", "//taxa_compra_manha"},
+}
+
+func newXMLTitulo(id string, rec Record) xmlTitulo {
+	return xmlTitulo{
+		ID:              id,
+		Nome:            rec.Nome,
+		DataInicio:      rec.DataInicio,
+		DataConversao:   rec.DataConversao,
+		DataVencimento:  rec.DataVencimento,
+		DataBase:        rec.DataBase,
+		TaxaCompraManha: formatFloat(rec.TaxaCompraManha),
+		TaxaVendaManha:  formatFloat(rec.TaxaVendaManha),
+		PUCompraManha:   formatFloat(rec.PUCompraManha),
+		PUVendaManha:    formatFloat(rec.PUVendaManha),
+		PUBaseManha:     formatFloat(rec.PUBaseManha),
+	}
+}
+
+// writeXML writes latest.xml with every record, plus one small file per bond
+// under xmlDir. Excel's WEBSERVICE rejects responses over 32,767 characters,
+// which the full list exceeds, so single-bond lookups should use the
+// per-bond files.
+func writeXML(envelope latestEnvelope, path, xmlDir string) error {
+	doc := xmlDocument{
+		Metadata: xmlMetadata{
+			SchemaVersion:      envelope.SchemaVersion,
+			GeneratedAt:        envelope.GeneratedAt,
+			SourceURL:          envelope.SourceURL,
+			SourceSHA256:       envelope.SourceSHA256,
+			SourceLastModified: envelope.SourceLastModified,
+			MaxDataBase:        envelope.MaxDataBase,
+			XPaths:             xmlXPaths,
+		},
+		Titulos: make([]xmlTitulo, len(envelope.Records)),
+	}
+	ids := bondSlugs(envelope.Records)
+	for i, rec := range envelope.Records {
+		doc.Titulos[i] = newXMLTitulo(ids[i], rec)
+	}
+
+	data, err := encodeXML(doc)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(xmlDir, 0755); err != nil {
+		return err
+	}
+	for _, titulo := range doc.Titulos {
+		data, err := encodeXML(titulo)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(xmlDir, titulo.ID+".xml"), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeXML(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", " ")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// formatFloat formats f with a dot decimal separator and no exponent.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteXML(t *testing.T) {
+	records := []Record{
+		{Nome: "Tesouro IPCA+ 2035", DataInicio: "2024-12-22", DataVencimento: "2035-05-15", DataBase: "2025-12-22", TaxaCompraManha: 7.29, PUVendaManha: 2348.76},
+		{Nome: "Tesouro Selic 2029", DataInicio: "2023-01-02", DataVencimento: "2029-03-01", DataBase: "2025-12-22", TaxaCompraManha: 0.00001},
+	}
+	envelope := newLatestEnvelope(records, "https://example.com/data.csv", "abc123", time.Date(2025, 12, 22, 10, 0, 0, 0, time.UTC))
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "latest.xml")
+	xmlDir := filepath.Join(dir, "xml")
+
+	require.NoError(t, writeXML(envelope, path, xmlDir))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var doc xmlDocument
+	require.NoError(t, xml.Unmarshal(data, &doc))
+	assert.Equal(t, "2025-12-22", doc.Metadata.MaxDataBase)
+	assert.Equal(t, "https://example.com/data.csv", doc.Metadata.SourceURL)
+	assert.NotEmpty(t, doc.Metadata.XPaths)
+	require.Len(t, doc.Titulos, 2)
+	assert.Equal(t, "tesouro-ipca-2035", doc.Titulos[0].ID)
+	assert.Equal(t, "7.29", doc.Titulos[0].TaxaCompraManha)
+	assert.Equal(t, "2348.76", doc.Titulos[0].PUVendaManha)
+	// No exponent notation
+	assert.Equal(t, "0.00001", doc.Titulos[1].TaxaCompraManha)
+
+	assert.Contains(t, string(data), "<titulo>\n   <id>tesouro-ipca-2035</id>")
+
+	data, err = os.ReadFile(filepath.Join(xmlDir, "tesouro-selic-2029.xml"))
+	require.NoError(t, err)
+	var titulo xmlTitulo
+	require.NoError(t, xml.Unmarshal(data, &titulo))
+	assert.Equal(t, "Tesouro Selic 2029", titulo.Nome)
+	assert.Equal(t, "2029-03-01", titulo.DataVencimento)
+}